@@ -0,0 +1,77 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Background notification errors.
+var (
+	ErrBackgroundAlert   = errors.New("background notification with alert, sound or badge")
+	ErrBackgroundContent = errors.New("background notification without content-available")
+)
+
+// NewBackground returns the background (silent) notification waking up the
+// app to get new data. The custom data is added to the payload next to the aps
+// dictionary with the content-available key.
+//
+// Background notifications are sent with the low priority: the system
+// throttles them and may deliver them in bursts or not at all. Do not send
+// more than a few background notifications per hour to the device; use
+// BackgroundLimiter to enforce it.
+func NewBackground(token, topic string, data map[string]interface{}) Notification {
+	payload := make(map[string]interface{}, len(data)+1)
+	for key, value := range data {
+		payload[key] = value
+	}
+	payload["aps"] = map[string]int{"content-available": 1}
+	return Notification{
+		Token:       token,
+		Topic:       topic,
+		LowPriority: true,
+		PushType:    PushTypeBackground,
+		Payload:     payload,
+	}
+}
+
+// checkBackground checks the payload of the background notification: the aps
+// dictionary must contain content-available without alert, sound or badge,
+// otherwise the notification is shown to the user and throttled.
+func checkBackground(payload []byte) error {
+	var data struct {
+		APS map[string]json.RawMessage `json:"aps"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return err
+	}
+	for _, key := range []string{"alert", "sound", "badge"} {
+		if _, ok := data.APS[key]; ok {
+			return ErrBackgroundAlert
+		}
+	}
+	if string(data.APS["content-available"]) != "1" {
+		return ErrBackgroundContent
+	}
+	return nil
+}
+
+// BackgroundLimiter returns a middleware limiting the background
+// notifications sent to each device to perHour notifications per hour. Other
+// notifications are sent without limits.
+func BackgroundLimiter(perHour int, policy LimitPolicy) Middleware {
+	if perHour < 1 {
+		perHour = 1
+	}
+	limiter := NewRateLimiter(time.Hour/time.Duration(perHour), 1, policy)
+	return func(next Sender) Sender {
+		limited := limiter.Middleware(next)
+		return SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+			if n.PushType == PushTypeBackground {
+				return limited.Send(ctx, n)
+			}
+			return next.Send(ctx, n)
+		})
+	}
+}
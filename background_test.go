@@ -0,0 +1,55 @@
+package apns
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBackground(t *testing.T) {
+	f := newFakeAPNs(t)
+	sender := Chain(f.client(t), Validate, BackgroundLimiter(2, LimitDrop))
+	n := NewBackground(testToken, "com.example.app",
+		map[string]interface{}{"sync": "inbox"})
+	if _, err := sender.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	r, body := f.last()
+	if r.Header.Get("apns-push-type") != PushTypeBackground ||
+		r.Header.Get("apns-priority") != "5" {
+		t.Error("bad headers:", r.Header)
+	}
+	if string(body) != `{"aps":{"content-available":1},"sync":"inbox"}` {
+		t.Error("bad payload:", string(body))
+	}
+	// the second background notification within the hour is dropped
+	_, err := sender.Send(context.Background(), n)
+	if err, ok := err.(*Error); !ok || err.Reason != "TooManyRequests" {
+		t.Error("background notification is not limited:", err)
+	}
+	// other notifications are not limited
+	alert := Notification{Token: testToken, Topic: "com.example.app",
+		Payload: `{"aps":{"alert":"Hello"}}`}
+	if _, err := sender.Send(context.Background(), alert); err != nil {
+		t.Error(err)
+	}
+
+	for _, test := range []struct {
+		payload string
+		err     error
+	}{
+		{`{"aps":{"content-available":1,"alert":"Hello"}}`, ErrBackgroundAlert},
+		{`{"aps":{"content-available":1,"sound":"default"}}`, ErrBackgroundAlert},
+		{`{"aps":{"content-available":1,"badge":1}}`, ErrBackgroundAlert},
+		{`{"aps":{}}`, ErrBackgroundContent},
+		{`{"aps":{"content-available":1},"id":1}`, nil},
+	} {
+		n.Payload = test.payload
+		if err := n.Validate(); err != test.err {
+			t.Errorf("bad error for %s: %v", test.payload, err)
+		}
+	}
+	n.LowPriority = false
+	if err, ok := n.Validate().(*Error); !ok || err.Reason != "BadPriority" {
+		t.Error("bad priority error:", err)
+	}
+}
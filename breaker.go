@@ -0,0 +1,232 @@
+package apns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Client.Send without sending the notification
+// while the circuit breaker of the client is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState describes the state of the CircuitBreaker.
+type BreakerState uint8
+
+// Circuit breaker states.
+const (
+	BreakerClosed   BreakerState = iota // notifications are sent
+	BreakerOpen                         // notifications fail fast
+	BreakerHalfOpen                     // a single trial notification is sent
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops sending notifications when APNs is unavailable.
+//
+// The breaker counts connection-level failures and APNs server errors (500
+// InternalServerError, 503 ServiceUnavailable and Shutdown, GOAWAY). It opens
+// after Failures consecutive failures or when the share of failures within
+// Window reaches ErrorRate. While open, Client.Send returns ErrCircuitOpen
+// immediately and ClientsPool stops dequeuing notifications. After
+// OpenTimeout the breaker becomes half-open and lets a single notification
+// through: its success closes the breaker, its failure opens it again.
+//
+// Set the breaker to Client.Breaker before sending notifications or creating
+// the pool.
+type CircuitBreaker struct {
+	Failures    int           // consecutive failures to open; 0 — disabled
+	ErrorRate   float64       // share of failures to open; 0 — disabled
+	MinRequests int           // minimum requests within Window for ErrorRate
+	Window      time.Duration // the period for counting ErrorRate
+	OpenTimeout time.Duration // time in the open state before a trial
+
+	// OnStateChange, if not nil, is called on every state transition. Use it
+	// to report transitions to metrics and tracing. It is called with the
+	// breaker locked and must not call the breaker methods.
+	OnStateChange func(from, to BreakerState)
+
+	mu          sync.Mutex
+	state       BreakerState
+	consecutive int           // consecutive failures
+	requests    int           // requests within the window
+	errors      int           // failures within the window
+	windowStart time.Time     // current window start time
+	openedAt    time.Time     // the time the breaker was opened
+	trial       bool          // trial notification in progress
+	changed     chan struct{} // closed on the state change or trial end
+}
+
+// NewCircuitBreaker returns a CircuitBreaker that opens after the given number
+// of consecutive failures and makes a trial after openTimeout.
+func NewCircuitBreaker(failures int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Failures:    failures,
+		OpenTimeout: openTimeout,
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpen(time.Now())
+	return b.state
+}
+
+// allow returns ErrCircuitOpen if the notification should not be sent.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpen(time.Now())
+	switch b.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// record counts the result of the sent notification.
+func (b *CircuitBreaker) record(err error) {
+	var failure = isOutage(err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if isCanceled(err) {
+		// the result is unknown: let another notification make a trial
+		if b.trial {
+			b.trial = false
+			b.notify()
+		}
+		return
+	}
+	if b.state == BreakerHalfOpen && b.trial {
+		b.trial = false
+		if failure {
+			b.setState(BreakerOpen, now)
+		} else {
+			b.setState(BreakerClosed, now)
+		}
+		return
+	}
+	if b.Window > 0 && now.Sub(b.windowStart) > b.Window {
+		b.windowStart, b.requests, b.errors = now, 0, 0
+	}
+	b.requests++
+	if !failure {
+		b.consecutive = 0
+		return
+	}
+	b.consecutive++
+	b.errors++
+	if b.state != BreakerClosed {
+		return
+	}
+	if (b.Failures > 0 && b.consecutive >= b.Failures) ||
+		(b.ErrorRate > 0 && b.requests >= b.MinRequests &&
+			float64(b.errors)/float64(b.requests) >= b.ErrorRate) {
+		b.setState(BreakerOpen, now)
+	}
+}
+
+// wait blocks while the breaker does not allow sending notifications.
+func (b *CircuitBreaker) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.halfOpen(now)
+		if b.state == BreakerClosed ||
+			(b.state == BreakerHalfOpen && !b.trial) {
+			b.mu.Unlock()
+			return nil
+		}
+		if b.changed == nil {
+			b.changed = make(chan struct{})
+		}
+		changed := b.changed
+		delay := b.openedAt.Add(b.OpenTimeout).Sub(now)
+		b.mu.Unlock()
+		if delay <= 0 {
+			delay = b.OpenTimeout
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// halfOpen switches the open breaker to the half-open state after the
+// timeout. It is called with the lock held.
+func (b *CircuitBreaker) halfOpen(now time.Time) {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.OpenTimeout {
+		b.setState(BreakerHalfOpen, now)
+	}
+}
+
+// setState changes the state of the breaker and notifies the waiting pool
+// workers and the OnStateChange hook. It is called with the lock held.
+func (b *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	from := b.state
+	b.state = state
+	switch state {
+	case BreakerOpen:
+		b.openedAt = now
+	case BreakerClosed:
+		b.consecutive, b.requests, b.errors = 0, 0, 0
+		b.windowStart = now
+	}
+	b.notify()
+	if b.OnStateChange != nil && from != state {
+		b.OnStateChange(from, state)
+	}
+}
+
+// notify wakes up the waiting pool workers. It is called with the lock held.
+func (b *CircuitBreaker) notify() {
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
+
+// isCanceled returns true if the request was canceled by the context.
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// isOutage returns true if the error indicates APNs or the connection
+// failure rather than a problem with the notification itself.
+func isOutage(err error) bool {
+	switch err := err.(type) {
+	case nil:
+		return false
+	case *Error:
+		return err.Status == 0 || err.Status >= 500
+	}
+	return !isCanceled(err)
+}
@@ -0,0 +1,137 @@
+package apns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	server := newFakeAPNs(t)
+	var (
+		mu          sync.Mutex
+		available   bool
+		transitions []BreakerState
+	)
+	server.reply = func(r *http.Request) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !available {
+			return http.StatusServiceUnavailable, "Shutdown"
+		}
+		return http.StatusOK, ""
+	}
+	client := server.client(t)
+	client.Breaker = NewCircuitBreaker(2, 50*time.Millisecond)
+	client.Breaker.OnStateChange = func(from, to BreakerState) {
+		transitions = append(transitions, to)
+	}
+	n := Notification{Token: testToken, Payload: `{"aps":{}}`}
+	for i := 0; i < 2; i++ {
+		if _, err := client.Push(n); err == nil {
+			t.Error("expected APNs error")
+		}
+	}
+	if _, err := client.Push(n); err != ErrCircuitOpen {
+		t.Error("bad open circuit error:", err)
+	}
+	if server.count() != 2 {
+		t.Error("bad request count:", server.count())
+	}
+
+	// the pool does not dequeue notifications while the breaker is open
+	pool := client.Pool(1, nil)
+	defer pool.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Send(ctx, n); err != context.DeadlineExceeded {
+		t.Error("bad paused pool error:", err)
+	}
+
+	mu.Lock()
+	available = true
+	mu.Unlock()
+	if _, err := pool.Send(context.Background(), n); err != nil {
+		t.Error(err)
+	}
+	if state := client.Breaker.State(); state != BreakerClosed {
+		t.Error("bad breaker state:", state)
+	}
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(transitions) != len(want) {
+		t.Fatal("bad transitions:", transitions)
+	}
+	for i, state := range want {
+		if transitions[i] != state {
+			t.Error("bad transitions:", transitions)
+		}
+	}
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	breaker := &CircuitBreaker{
+		ErrorRate:   0.5,
+		MinRequests: 4,
+		Window:      time.Minute,
+		OpenTimeout: time.Minute,
+	}
+	for _, err := range []error{nil, errors.New("tls: handshake failure"), nil,
+		&Error{Status: 500}} {
+		if breaker.State() != BreakerClosed {
+			t.Fatal("breaker opened too early")
+		}
+		breaker.record(err)
+	}
+	if breaker.State() != BreakerOpen {
+		t.Error("bad breaker state:", breaker.State())
+	}
+	// token errors do not open the breaker
+	if isOutage(&Error{Status: 410, Reason: "Unregistered"}) {
+		t.Error("token error counted as outage")
+	}
+}
+
+func TestCircuitBreakerIdleWorkers(t *testing.T) {
+	server := newFakeAPNs(t)
+	var (
+		mu        sync.Mutex
+		available bool
+	)
+	server.reply = func(r *http.Request) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !available {
+			return http.StatusServiceUnavailable, "Shutdown"
+		}
+		return http.StatusOK, ""
+	}
+	client := server.client(t)
+	client.Breaker = NewCircuitBreaker(1, 50*time.Millisecond)
+	responses := make(chan Response, 3)
+	pool := client.Pool(2, responses)
+	defer pool.Close()
+	n := Notification{Token: testToken, Payload: `{"aps":{}}`}
+	// the failure opens the breaker while the other worker waits idle
+	pool.Push(n, "01")
+	if r := <-responses; r.Error == nil {
+		t.Fatal("expected APNs error")
+	}
+	if state := client.Breaker.State(); state != BreakerOpen {
+		t.Fatal("bad breaker state:", state)
+	}
+	mu.Lock()
+	available = true
+	mu.Unlock()
+	pool.Push(n, "02", "03")
+	for i := 0; i < 2; i++ {
+		if r := <-responses; r.Error != nil {
+			t.Errorf("%s: %v", r.Token, r.Error)
+		}
+	}
+	if server.count() != 3 {
+		t.Error("bad request count:", server.count())
+	}
+}
@@ -0,0 +1,193 @@
+package apns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// APNs channel management server hosts.
+const (
+	ChannelProductionHost  = "https://api-manage-broadcast.push.apple.com:2196"
+	ChannelDevelopmentHost = "https://api-manage-broadcast.sandbox.push.apple.com:2195"
+)
+
+// MessageStoragePolicy tells APNs whether to store the last broadcast message
+// of the channel for the offline devices.
+type MessageStoragePolicy int
+
+// Channel message storage policies.
+const (
+	NoMessageStored         MessageStoragePolicy = 0
+	MostRecentMessageStored MessageStoragePolicy = 1
+)
+
+// Channel describes the broadcast channel of the app.
+type Channel struct {
+	ID            string               `json:"-"`
+	StoragePolicy MessageStoragePolicy `json:"message-storage-policy"`
+	PushType      string               `json:"push-type"`
+}
+
+// ChannelManager manages the broadcast channels of the apps. Devices subscribe
+// to the channel to receive the Live Activity updates broadcast with one
+// request by Client.Broadcast.
+//
+// The manager sends requests with the connections and the authorization of
+// its client.
+type ChannelManager struct {
+	Host   string // channel management server
+	client *Client
+}
+
+// NewChannelManager returns the channel manager for the client. The host of
+// the manager is selected by the environment of the client.
+func NewChannelManager(client *Client) *ChannelManager {
+	host := ChannelProductionHost
+	if client.Host == DevelopmentHost {
+		host = ChannelDevelopmentHost
+	}
+	return &ChannelManager{Host: host, client: client}
+}
+
+// do sends the channel management request for the app and returns the
+// response with the expected status.
+func (m *ChannelManager) do(ctx context.Context, method, bundleID, path,
+	channelID string, body interface{}, status int) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method,
+		m.Host+"/1/apps/"+bundleID+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if channelID != "" {
+		req.Header.Set("apns-channel-id", channelID)
+	}
+	resp, err := m.client.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != status {
+		defer resp.Body.Close()
+		return nil, parseError(resp.StatusCode, resp.Body)
+	}
+	return resp, nil
+}
+
+// Create creates the Live Activity broadcast channel for the app and returns
+// its ID.
+func (m *ChannelManager) Create(ctx context.Context, bundleID string,
+	policy MessageStoragePolicy) (string, error) {
+	resp, err := m.do(ctx, http.MethodPost, bundleID, "/channels", "",
+		&Channel{StoragePolicy: policy, PushType: "LiveActivity"},
+		http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("apns-channel-id"), nil
+}
+
+// Channel returns the configuration of the channel.
+func (m *ChannelManager) Channel(ctx context.Context, bundleID,
+	channelID string) (*Channel, error) {
+	resp, err := m.do(ctx, http.MethodGet, bundleID, "/channels", channelID,
+		nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var channel = &Channel{ID: channelID}
+	if err := json.NewDecoder(resp.Body).Decode(channel); err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+// List returns the IDs of all channels of the app.
+func (m *ChannelManager) List(ctx context.Context, bundleID string) (
+	[]string, error) {
+	resp, err := m.do(ctx, http.MethodGet, bundleID, "/all-channels", "",
+		nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Channels []string `json:"channels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list.Channels, nil
+}
+
+// Delete deletes the channel of the app.
+func (m *ChannelManager) Delete(ctx context.Context, bundleID,
+	channelID string) error {
+	resp, err := m.do(ctx, http.MethodDelete, bundleID, "/channels", channelID,
+		nil, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Broadcast sends the notification to all devices subscribed to the channel.
+// The notification Token is ignored, and the Topic is the bundle ID of the
+// app; the Live Activity topic suffix is trimmed. The push type is
+// liveactivity, if not set.
+//
+// It returns the request ID assigned by APNs.
+func (c *Client) Broadcast(channelID string, notification Notification) (
+	id string, err error) {
+	result, err := c.SendBroadcast(context.Background(), channelID, notification)
+	return result.ID, err
+}
+
+// SendBroadcast sends the notification to all devices subscribed to the
+// channel like Broadcast. The context controls the lifetime of the request.
+func (c *Client) SendBroadcast(ctx context.Context, channelID string,
+	notification Notification) (result Result, err error) {
+	result = Result{Attempts: 1}
+	notification.Token = ""
+	notification.Topic = bundleID(notification.Topic)
+	if notification.Topic == "" && c.ci != nil {
+		notification.Topic = c.ci.BundleID
+	}
+	if notification.PushType == "" {
+		notification.PushType = PushTypeLiveActivity
+	}
+	base, err := c.baseURL()
+	if err != nil {
+		return result, err
+	}
+	req, body, err := notification.request(base,
+		"/4/broadcasts/apps/"+notification.Topic)
+	if err != nil {
+		return result, err
+	}
+	defer body.release()
+	delete(req.Header, "Apns-Topic")
+	req.Header["Apns-Channel-Id"] = []string{channelID}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	result.ID = resp.Header.Get("apns-request-id")
+	if resp.StatusCode == http.StatusOK {
+		return result, nil
+	}
+	return result, parseError(resp.StatusCode, resp.Body)
+}
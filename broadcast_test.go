@@ -0,0 +1,67 @@
+package apns
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	f := newFakeAPNs(t)
+	client, _ := f.tokenClient(t)
+	manager := NewChannelManager(client)
+	if manager.Host != ChannelProductionHost {
+		t.Error("bad channel host:", manager.Host)
+	}
+	manager.Host = f.URL
+	ctx := context.Background()
+	id, err := manager.Create(ctx, "com.example.app", MostRecentMessageStored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := f.last()
+	if r.URL.Path != "/1/apps/com.example.app/channels" ||
+		r.Header.Get("authorization") == "" {
+		t.Error("bad create request:", r.URL.Path, r.Header)
+	}
+	channel, err := manager.Channel(ctx, "com.example.app", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.ID != id || channel.StoragePolicy != MostRecentMessageStored ||
+		channel.PushType != "LiveActivity" {
+		t.Error("bad channel:", channel)
+	}
+	if list, err := manager.List(ctx, "com.example.app"); err != nil {
+		t.Fatal(err)
+	} else if len(list) != 1 || list[0] != id {
+		t.Error("bad channels list:", list)
+	}
+
+	activity := &LiveActivity{Event: LiveActivityUpdate, ContentState: 1}
+	n, err := activity.Notification("", "com.example.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestID, err := client.Broadcast(id, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ = f.last()
+	if r.URL.Path != "/4/broadcasts/apps/com.example.app" ||
+		r.Header.Get("apns-channel-id") != id ||
+		r.Header.Get("apns-push-type") != PushTypeLiveActivity || requestID == "" {
+		t.Error("bad broadcast request:", r.URL.Path, r.Header, requestID)
+	}
+
+	if err := manager.Delete(ctx, "com.example.app", id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = manager.Channel(ctx, "com.example.app", id)
+	if err, ok := err.(*Error); !ok || err.Reason != "ChannelNotRegistered" {
+		t.Error("bad deleted channel error:", err)
+	}
+	_, err = client.Broadcast(id, n)
+	if err, ok := err.(*Error); !ok || err.Reason != "BadChannelId" {
+		t.Error("bad broadcast error:", err)
+	}
+}
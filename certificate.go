@@ -44,6 +44,8 @@ type CertificateInfo struct {
 	Development bool      // sandbox support flag
 	Production  bool      // production support flag
 	IsApple     bool      // certificate signed by Apple flag
+	MDM         bool      // MDM push certificate flag
+	Website     bool      // Safari website push certificate flag
 	Expire      time.Time // expire date and time
 }
 
@@ -104,6 +106,8 @@ func GetCertificateInfo(certificate *tls.Certificate) *CertificateInfo {
 			}
 		}
 	}
+	info.MDM = isMDM(info.BundleID)
+	info.Website = isWebsite(info.BundleID)
 	return info
 }
 
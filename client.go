@@ -1,11 +1,12 @@
 package apns
 
 import (
+	"context"
 	"crypto/tls"
-	"fmt"
 	"net/http"
 	"net/url"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -14,6 +15,10 @@ import (
 // Timeout contains the maximum waiting time connection to the APNS server.
 var Timeout = 15 * time.Second
 
+// PingInterval is the default interval of the HTTP/2 PING frames checking
+// the health of the idle connections to APNs.
+var PingInterval = time.Minute
+
 // Client supports APNs Provider API.
 //
 // The APNs provider API lets you send remote notifications to your app on iOS,
@@ -24,8 +29,9 @@ var Timeout = 15 * time.Second
 //
 // The first step in sending a remote notification is to establish a connection
 // with the appropriate APNs server Host:
-// 	Development server: api.development.push.apple.com:443
-// 	Production server:  api.push.apple.com:443
+//
+//	Development server: api.development.push.apple.com:443
+//	Production server:  api.push.apple.com:443
 //
 // Note: You can alternatively use port 2197 when communicating with APNs. You
 // might do this, for example, to allow APNs traffic through your firewall but
@@ -42,33 +48,61 @@ var Timeout = 15 * time.Second
 // connections when existing certificate or the key used to sign provider tokens
 // is revoked.
 type Client struct {
-	Host       string           // http URL
+	Host    string          // http URL
+	Breaker *CircuitBreaker // circuit breaker; nil — disabled
+	// OnGoAway, if not nil, is called when APNs terminates the connection
+	// with the GOAWAY frame. Use it to report the reason to monitoring. The
+	// client keeps sending after the fatal reason: the notifications fail
+	// with the same error until the credentials are replaced.
+	//
+	// Only the Transport set with EnableHPACK reports every GOAWAY frame with
+	// the number of unprocessed streams. The default transport reports the
+	// frame only when it fails a request, with zero Unprocessed.
+	OnGoAway func(GoAway)
+
 	ci         *CertificateInfo // certificate
 	token      *ProviderToken   // provider token
 	httpСlient *http.Client     // http client for push
+	h2         *http2.Transport // HTTP/2 settings of the http transport
+	topics     map[string]Topic // served topics; empty — any topic
+	mu         sync.RWMutex
+	base       atomic.Pointer[hostURL]    // parsed Host
+	auth       atomic.Pointer[authHeader] // authorization of the last JWT
+	state      atomic.Int32               // ConnState
+	connect    *connectCall               // the last Connect
 }
 
+// APNs server hosts.
+const (
+	ProductionHost  = "https://api.push.apple.com"
+	DevelopmentHost = "https://api.development.push.apple.com"
+)
+
 func newClient(certificate *tls.Certificate, pt *ProviderToken) *Client {
 	client := &Client{
-		Host:       "https://api.push.apple.com",
+		Host:       ProductionHost,
 		httpСlient: &http.Client{Timeout: Timeout},
 	}
 	if pt != nil {
 		client.token = pt
 	}
+	// every client has its own connections to APNs
+	transport := &http.Transport{TLSClientConfig: new(tls.Config)}
 	if certificate != nil {
-		transport := &http.Transport{
-			TLSClientConfig: &tls.Config{
-				Certificates: []tls.Certificate{*certificate}}}
-		if err := http2.ConfigureTransport(transport); err != nil {
-			panic(err) // HTTP/2 initialization error
-		}
-		client.httpСlient.Transport = transport
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*certificate}
 		client.ci = GetCertificateInfo(certificate)
 		if !client.ci.Production {
-			client.Host = "https://api.development.push.apple.com"
+			client.Host = DevelopmentHost
 		}
 	}
+	h2, err := http2.ConfigureTransports(transport)
+	if err != nil {
+		panic(err) // HTTP/2 initialization error
+	}
+	// ping the connections idle for the interval and close them on timeout
+	h2.ReadIdleTimeout, h2.PingTimeout = PingInterval, Timeout
+	client.h2 = h2
+	client.httpСlient.Transport = transport
 	return client
 }
 
@@ -78,6 +112,10 @@ func New(certificate tls.Certificate) *Client {
 
 // NewWithToken returns an initialized Client with JSON Web Token (JWT)
 // authentication support.
+//
+// The provider token can serve every app of the team: use one client to send
+// notifications to all its topics over the same connections. Add the topics
+// with AddTopic to check them and set the default push types locally.
 func NewWithToken(pt *ProviderToken) *Client {
 	return newClient(nil, pt)
 }
@@ -90,57 +128,118 @@ func NewWithToken(pt *ProviderToken) *Client {
 // of that request.
 //
 // Response from APNs:
-// 	- The apns-id value from the request. If no value was included in the
-//	  request, the server creates a new UUID and returns it in this header.
-// 	- :status - the HTTP status code.
-//	- reason - the error indicating the reason for the failure. The error code
-// 	  is specified as a string.
-//	- timestamp - if the value in the :status header is 410, the value of this
-//	  key is the last time at which APNs confirmed that the device token was no
-//	  longer valid for the topic. Stop pushing notifications until the device
-//	  registers a token with a later timestamp with your provider.
+//   - The apns-id value from the request. If no value was included in the
+//     request, the server creates a new UUID and returns it in this header.
+//   - :status - the HTTP status code.
+//   - reason - the error indicating the reason for the failure. The error code
+//     is specified as a string.
+//   - timestamp - if the value in the :status header is 410, the value of this
+//     key is the last time at which APNs confirmed that the device token was no
+//     longer valid for the topic. Stop pushing notifications until the device
+//     registers a token with a later timestamp with your provider.
 func (c *Client) Push(notification Notification) (id string, err error) {
-	req, err := notification.request(c.Host)
+	result, err := c.Send(context.Background(), notification)
+	return result.ID, err
+}
+
+// Send sends the notification to APNs and implements the Sender interface.
+// The context controls the lifetime of the HTTP/2 request.
+func (c *Client) Send(ctx context.Context, notification Notification) (
+	result Result, err error) {
+	result = Result{Token: notification.Token, Attempts: 1}
+	if err := c.checkTopic(&notification); err != nil {
+		return result, err
+	}
+	if err := c.pushKitTopic(&notification); err != nil {
+		return result, err
+	}
+	if notification.PushType == "" && c.ci != nil && c.ci.MDM {
+		notification.PushType = PushTypeMDM
+	}
+	base, err := c.baseURL()
 	if err != nil {
-		return "", err
+		return result, err
 	}
-	req.Header.Set("user-agent", "mdigger-apns/3.1")
+	req, body, err := notification.request(base, "/3/device/"+notification.Token)
+	if err != nil {
+		return result, err
+	}
+	defer body.release()
 	// add default certificate topic
 	if notification.Topic == "" && c.ci != nil && len(c.ci.Topics) > 0 {
 		// If your certificate includes multiple topics, you must specify a
 		// value for this header.
-		req.Header.Set("apns-topic", c.ci.BundleID)
+		req.Header["Apns-Topic"] = []string{c.ci.BundleID}
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	// For a successful request, the body of the response is empty. On failure,
+	// the response body contains a JSON dictionary.
+	defer resp.Body.Close()
+	result.ID = resp.Header.Get("apns-id")
+	if resp.StatusCode == http.StatusOK {
+		return result, nil
 	}
+	return result, parseError(resp.StatusCode, resp.Body)
+}
+
+// do sends the request to APNs with the client authorization. The GOAWAY
+// frame of the terminated connection is returned as *Error.
+func (c *Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	req = req.WithContext(ctx)
+	req.Header["User-Agent"] = headerUserAgent
 	if c.token != nil {
 		// The provider token that authorizes APNs to send push notifications
 		// for the specified topics. The token is in Base64URL-encoded JWT
 		// format, specified as bearer <provider token>.
 		// When the provider certificate is used to establish a connection, this
 		// request header is ignored.
-		if token, err := c.token.JWT(); err == nil {
-			req.Header.Set("authorization", fmt.Sprintf("bearer %s", token))
+		if auth := c.authorization(); auth != nil {
+			req.Header["Authorization"] = auth
 		}
 	}
 
+	if c.Breaker != nil {
+		if err := c.Breaker.allow(); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
 	resp, err := c.httpСlient.Do(req)
+	if c.Breaker != nil {
+		c.Breaker.record(responseError(resp, err))
+	}
 	if err, ok := err.(*url.Error); ok {
 		// If APNs decides to terminate an established HTTP/2 connection, it
 		// sends a GOAWAY frame. The GOAWAY frame includes JSON data in its
 		// payload with a reason key, whose value indicates the reason for the
 		// connection termination.
+		// The Transport reports the GOAWAY frame when it is received; the
+		// streams not processed by APNs are resent by both transports.
 		if err, ok := err.Err.(http2.GoAwayError); ok {
-			return "", parseError(0, strings.NewReader(err.DebugData))
+			if _, ok := c.httpСlient.Transport.(*Transport); !ok {
+				c.goAway(newGoAway(err, 0))
+			}
+			return nil, goAwayError(err)
 		}
 	}
-	if err != nil {
-		return "", err
-	}
-	// For a successful request, the body of the response is empty. On failure,
-	// the response body contains a JSON dictionary.
-	defer resp.Body.Close()
-	id = resp.Header.Get("apns-id")
-	if resp.StatusCode == http.StatusOK {
-		return id, nil
+	return resp, err
+}
+
+// Close closes the idle connections of the client to APNs.
+func (c *Client) Close() {
+	c.httpСlient.CloseIdleConnections()
+}
+
+// responseError returns the error for the circuit breaker: the connection
+// error or the status of the APNs response.
+func responseError(resp *http.Response, err error) error {
+	if err != nil || resp.StatusCode == http.StatusOK {
+		return err
 	}
-	return id, parseError(resp.StatusCode, resp.Body)
+	return &Error{Status: resp.StatusCode}
 }
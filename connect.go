@@ -0,0 +1,149 @@
+package apns
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ConnState is the readiness state of the Client connection.
+type ConnState int32
+
+// Client connection states.
+const (
+	ConnIdle       ConnState = iota // not connected in advance
+	ConnConnecting                  // Connect is in progress
+	ConnReady                       // connected and authorized
+	ConnFailed                      // the last Connect failed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnIdle:
+		return "idle"
+	case ConnConnecting:
+		return "connecting"
+	case ConnReady:
+		return "ready"
+	case ConnFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// probeToken is the device token of the warm-up request: APNs authorizes the
+// request and rejects the token, so no notification is delivered.
+var probeToken = strings.Repeat("0", 64)
+
+// connectCall is the Connect in progress.
+type connectCall struct {
+	done chan struct{}
+	err  error
+}
+
+// State returns the readiness state of the client connection.
+func (c *Client) State() ConnState {
+	return ConnState(c.state.Load())
+}
+
+// Connect establishes the connection to APNs in advance, so the first
+// notification does not pay for DNS, TCP, TLS and HTTP/2 handshakes.
+//
+// With the provider token, APNs allows only one stream on the connection
+// until it sees the valid token, so Connect sends one authenticated request
+// first: the notification without payload to the invalid device token that
+// APNs rejects without delivering anything. The error is returned if APNs
+// rejects the authorization.
+//
+// Connect warms up one connection to the client host: the notifications are
+// multiplexed over it, and the transport dials more connections only when
+// its streams are busy.
+//
+// While the State is ConnConnecting, the pool workers hold the dequeued
+// notifications and send them when Connect is done, whether it succeeded or
+// not: after the failed Connect the workers dial on demand and report the
+// APNs errors for the notifications.
+//
+// The concurrent calls wait for the same Connect.
+func (c *Client) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	if call := c.connect; call != nil && c.State() == ConnConnecting {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &connectCall{done: make(chan struct{})}
+	c.connect = call
+	c.state.Store(int32(ConnConnecting))
+	c.mu.Unlock()
+
+	call.err = c.warmUp(ctx)
+	if call.err != nil {
+		c.state.Store(int32(ConnFailed))
+	} else {
+		c.state.Store(int32(ConnReady))
+	}
+	close(call.done)
+	return call.err
+}
+
+// waitConnect waits for Connect in progress.
+func (c *Client) waitConnect(ctx context.Context) {
+	if c.State() != ConnConnecting {
+		return
+	}
+	c.mu.RLock()
+	call := c.connect
+	c.mu.RUnlock()
+	if call == nil {
+		return
+	}
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+	}
+}
+
+// warmUp establishes the connection and authorizes the provider token.
+func (c *Client) warmUp(ctx context.Context) error {
+	if _, ok := c.httpСlient.Transport.(*Transport); ok && c.token == nil {
+		return c.Ping(ctx)
+	}
+	base, err := c.baseURL()
+	if err != nil {
+		return err
+	}
+	n := Notification{Token: probeToken, Payload: []byte("{}")}
+	if c.token != nil {
+		c.mu.RLock()
+		topics := make([]string, 0, len(c.topics))
+		for name := range c.topics {
+			topics = append(topics, name)
+		}
+		c.mu.RUnlock()
+		if len(topics) > 0 {
+			sort.Strings(topics)
+			n.Topic = topics[0]
+		}
+	}
+	req, body, err := n.request(base, "/3/device/"+probeToken)
+	if err != nil {
+		return err
+	}
+	defer body.release()
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusForbidden {
+		return parseError(resp.StatusCode, resp.Body)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package apns
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnect(t *testing.T) {
+	f := newFakeAPNs(t)
+	probed, release := make(chan struct{}), make(chan struct{})
+	f.reply = func(r *http.Request) (int, string) {
+		if strings.HasSuffix(r.URL.Path, probeToken) {
+			close(probed)
+			<-release
+			return http.StatusBadRequest, "BadDeviceToken"
+		}
+		return http.StatusOK, ""
+	}
+	client, key := f.tokenClient(t)
+	client.AddTopic(Topic{Name: "com.example.app"})
+	if state := client.State(); state != ConnIdle {
+		t.Fatal("bad state:", state)
+	}
+	connected := make(chan error, 1)
+	go func() { connected <- client.Connect(context.Background()) }()
+	<-probed
+	if state := client.State(); state != ConnConnecting {
+		t.Fatal("bad state:", state)
+	}
+
+	// the pool waits for the warm-up
+	responses := make(chan Response, 1)
+	pool := client.Pool(1, responses)
+	pool.Push(Notification{Topic: "com.example.app"}, testToken)
+	time.Sleep(20 * time.Millisecond)
+	if n := f.count(); n != 1 {
+		t.Fatalf("%d requests before connected", n)
+	}
+	close(release)
+	if err := <-connected; err != nil {
+		t.Fatal(err)
+	}
+	if r := <-responses; r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if state := client.State(); state != ConnReady {
+		t.Error("bad state:", state)
+	}
+	f.mu.Lock()
+	probe, body := f.requests[0], f.bodies[0]
+	f.mu.Unlock()
+	if probe.Header.Get("apns-topic") != "com.example.app" || string(body) != "{}" {
+		t.Error("bad warm-up request:", probe.URL, probe.Header, string(body))
+	}
+	verifyJWT(t, strings.TrimPrefix(probe.Header.Get("authorization"), "bearer "), key)
+
+	// the workers wait for Connect started after the pool is created
+	probed, release = make(chan struct{}), make(chan struct{})
+	f.mu.Lock()
+	f.reply = func(r *http.Request) (int, string) {
+		if strings.HasSuffix(r.URL.Path, probeToken) {
+			close(probed)
+			<-release
+		}
+		return http.StatusOK, ""
+	}
+	f.mu.Unlock()
+	go func() { connected <- client.Connect(context.Background()) }()
+	<-probed
+	pool.Push(Notification{Topic: "com.example.app"}, testToken)
+	time.Sleep(20 * time.Millisecond)
+	if n := f.count(); n != 3 {
+		t.Fatalf("%d requests before connected", n)
+	}
+	close(release)
+	if err := <-connected; err != nil {
+		t.Fatal(err)
+	}
+	if r := <-responses; r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if n := f.count(); n != 4 {
+		t.Error("bad requests count:", n)
+	}
+
+	f.mu.Lock()
+	f.reply = func(r *http.Request) (int, string) {
+		return http.StatusForbidden, "InvalidProviderToken"
+	}
+	f.mu.Unlock()
+	err := client.Connect(context.Background())
+	if err, ok := err.(*Error); !ok || err.Reason != "InvalidProviderToken" {
+		t.Error("bad error:", err)
+	}
+	if state := client.State(); state != ConnFailed {
+		t.Error("bad state:", state)
+	}
+}
@@ -0,0 +1,226 @@
+package apns
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter describes a pushed notification that was permanently rejected by
+// APNs.
+type DeadLetter struct {
+	Notification Notification // the rejected notification
+	Error        *Error       // the final error
+	Attempts     int          // number of attempts made to send
+	Queued       time.Time    // the time the notification was queued
+	Failed       time.Time    // the time of the final response
+}
+
+// jsonDeadLetter is a dead letter in JSON format.
+type jsonDeadLetter struct {
+	Notification *jsonNotification `json:"notification"`
+	Error        *Error            `json:"error"`
+	Attempts     int               `json:"attempts"`
+	Queued       time.Time         `json:"queued"`
+	Failed       time.Time         `json:"failed"`
+}
+
+// MarshalJSON returns the description of the DeadLetter using the JSON
+// format.
+func (dl DeadLetter) MarshalJSON() ([]byte, error) {
+	jn, err := newJSONNotification(dl.Notification)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&jsonDeadLetter{
+		Notification: jn,
+		Error:        dl.Error,
+		Attempts:     dl.Attempts,
+		Queued:       dl.Queued,
+		Failed:       dl.Failed,
+	})
+}
+
+// UnmarshalJSON restores the DeadLetter from a JSON format. The payload of the
+// restored notification is json.RawMessage.
+func (dl *DeadLetter) UnmarshalJSON(data []byte) error {
+	var jsonDL = new(jsonDeadLetter)
+	if err := json.Unmarshal(data, jsonDL); err != nil {
+		return err
+	}
+	*dl = DeadLetter{
+		Error:    jsonDL.Error,
+		Attempts: jsonDL.Attempts,
+		Queued:   jsonDL.Queued,
+		Failed:   jsonDL.Failed,
+	}
+	if jsonDL.Notification != nil {
+		dl.Notification = jsonDL.Notification.notification()
+	}
+	return nil
+}
+
+// DeadLetterSink receives the notifications permanently rejected by APNs.
+type DeadLetterSink interface {
+	Put(dl DeadLetter) error
+}
+
+// SetDeadLetterSink makes the pool put the pushed notifications that were
+// rejected by APNs into the sink: notifications with errors other than device
+// token errors (see Error.IsToken). Temporary errors (see Error.Temporary) are
+// put only after the exhausted retries, when Result.Attempts is more than one
+// (see Retry). The response is sent to the responses channel as well. If the sink fails to
+// put the notification, the response error wraps both the APNs error and the
+// sink error. Call it before pushing notifications to the pool.
+func (p *ClientsPool) SetDeadLetterSink(sink DeadLetterSink) {
+	p.deadLetters = sink
+}
+
+// deadLetter puts the rejected notification into the dead letter sink and
+// returns the response error.
+func (p *ClientsPool) deadLetter(item poolItem, result Result, err error) error {
+	apnsErr, ok := err.(*Error)
+	if p.deadLetters == nil || !ok || apnsErr.IsToken() ||
+		(apnsErr.Temporary() && result.Attempts < 2) {
+		return err
+	}
+	n := item.notification
+	if n.ID == "" {
+		n.ID = result.ID
+	}
+	if putErr := p.deadLetters.Put(DeadLetter{
+		Notification: n,
+		Error:        apnsErr,
+		Attempts:     result.Attempts,
+		Queued:       item.queued,
+		Failed:       time.Now(),
+	}); putErr != nil {
+		return fmt.Errorf("%w (dead letter: %v)", apnsErr, putErr)
+	}
+	return err
+}
+
+// DeadLetterFile is a DeadLetterSink writing dead letters to a file in JSON
+// Lines format: one JSON object per line.
+type DeadLetterFile struct {
+	filename string
+	mu       sync.Mutex
+	file     *os.File
+}
+
+// OpenDeadLetterFile opens or creates the dead letters file for appending.
+func OpenDeadLetterFile(filename string) (*DeadLetterFile, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterFile{filename: filename, file: file}, nil
+}
+
+// Put appends the dead letter to the file.
+func (f *DeadLetterFile) Put(dl DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	_, err = f.file.Write(append(data, '\n'))
+	return err
+}
+
+// Replay pushes the dead letters from the file to the pool again and removes
+// them from the file after they are pushed. Use it after fixing the cause of
+// the failures. The notifications failing again are written to the file anew
+// if the pool uses it as the dead letter sink. It returns the number of pushed
+// notifications.
+func (f *DeadLetterFile) Replay(pool *ClientsPool) (int, error) {
+	f.mu.Lock()
+	if f.file == nil {
+		f.mu.Unlock()
+		return 0, os.ErrClosed
+	}
+	// the letters are appended with the lock held, so the size is the end
+	// of the read letters
+	info, err := f.file.Stat()
+	var letters []DeadLetter
+	if err == nil {
+		letters, err = ReadDeadLetters(f.filename)
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	for _, dl := range letters {
+		pool.Push(dl.Notification, dl.Notification.Token)
+	}
+	return len(letters), f.removeHead(info.Size())
+}
+
+// removeHead removes the first size bytes of the file, keeping the letters
+// written after them. The rest is written to a temporary file that replaces
+// the file, so a crash does not lose any letters.
+func (f *DeadLetterFile) removeHead(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	data, err := ioutil.ReadFile(f.filename)
+	if err != nil {
+		return err
+	}
+	tmp := f.filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data[size:], 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.filename); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	f.file.Close()
+	f.file, err = os.OpenFile(f.filename, os.O_WRONLY|os.O_APPEND, 0600)
+	return err
+}
+
+// Close closes the file.
+func (f *DeadLetterFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// ReadDeadLetters returns the dead letters stored in the file.
+func ReadDeadLetters(filename string) ([]DeadLetter, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &dl); err != nil {
+			return letters, err
+		}
+		letters = append(letters, dl)
+	}
+	return letters, scanner.Err()
+}
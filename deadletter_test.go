@@ -0,0 +1,136 @@
+package apns
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterFile(t *testing.T) {
+	server := newFakeAPNs(t)
+	var topicAllowed int32
+	server.reply = func(r *http.Request) (int, string) {
+		switch {
+		case r.URL.Path == "/3/device/02":
+			return http.StatusGone, "Unregistered"
+		case atomic.LoadInt32(&topicAllowed) == 0:
+			return http.StatusBadRequest, "TopicDisallowed"
+		}
+		return http.StatusOK, ""
+	}
+	filename := filepath.Join(t.TempDir(), "dead.jsonl")
+	sink, err := OpenDeadLetterFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	responses := make(chan Response, 2)
+	pool := server.client(t).Pool(1, responses)
+	defer pool.Close()
+	pool.SetDeadLetterSink(sink)
+	pool.Push(Notification{Topic: "com.example.app",
+		Payload: `{"aps":{"alert":"Hello"}}`}, "01", "02")
+	<-responses
+	<-responses
+
+	letters, err := ReadDeadLetters(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 {
+		t.Fatal("bad dead letters count:", len(letters))
+	}
+	dl := letters[0]
+	if dl.Notification.Token != "01" || dl.Notification.Topic != "com.example.app" ||
+		string(dl.Notification.Payload.(json.RawMessage)) != `{"aps":{"alert":"Hello"}}` ||
+		dl.Error.Reason != "TopicDisallowed" || dl.Attempts != 1 ||
+		dl.Queued.IsZero() || dl.Failed.Before(dl.Queued) {
+		t.Errorf("bad dead letter: %+v", dl)
+	}
+
+	atomic.StoreInt32(&topicAllowed, 1)
+	count, err := sink.Replay(pool)
+	if err != nil || count != 1 {
+		t.Fatal("bad replay:", count, err)
+	}
+	if r := <-responses; r.Error != nil {
+		t.Error(r.Error)
+	}
+	if letters, _ := ReadDeadLetters(filename); len(letters) != 0 {
+		t.Error("dead letters are not cleared:", len(letters))
+	}
+}
+
+// failingSink is a DeadLetterSink failing to put the letters.
+type failingSink struct {
+	puts int32
+}
+
+func (s *failingSink) Put(dl DeadLetter) error {
+	atomic.AddInt32(&s.puts, 1)
+	return errors.New("disk is full")
+}
+
+func TestDeadLetterSinkErrors(t *testing.T) {
+	server := newFakeAPNs(t)
+	server.reply = func(r *http.Request) (int, string) {
+		if r.URL.Path == "/3/device/01" {
+			return http.StatusServiceUnavailable, "ServiceUnavailable"
+		}
+		return http.StatusBadRequest, "TopicDisallowed"
+	}
+	sink := new(failingSink)
+	responses := make(chan Response, 2)
+	pool := server.client(t).Pool(1, responses)
+	defer pool.Close()
+	pool.SetDeadLetterSink(sink)
+	pool.Push(Notification{Payload: `{"aps":{}}`}, "01", "02")
+	for i := 0; i < 2; i++ {
+		r := <-responses
+		var apnsErr *Error
+		if !errors.As(r.Error, &apnsErr) {
+			t.Fatal("bad error:", r.Error)
+		}
+		// the temporary error is not a dead letter
+		if wrapped := r.Error != error(apnsErr); wrapped != (r.Token == "02") {
+			t.Error("bad sink error:", r.Token, r.Error)
+		}
+	}
+	if puts := atomic.LoadInt32(&sink.puts); puts != 1 {
+		t.Error("bad dead letters count:", puts)
+	}
+}
+
+func TestDeadLetterRetries(t *testing.T) {
+	server := newFakeAPNs(t)
+	server.reply = func(r *http.Request) (int, string) {
+		return http.StatusServiceUnavailable, "ServiceUnavailable"
+	}
+	client := server.client(t)
+	sink := new(failingSink)
+	responses := make(chan Response, 2)
+	// the temporary error without retries is not a dead letter
+	pool := client.Pool(1, responses)
+	pool.SetDeadLetterSink(sink)
+	pool.Push(Notification{Payload: `{"aps":{}}`}, "01")
+	<-responses
+	pool.Close()
+	if puts := atomic.LoadInt32(&sink.puts); puts != 0 {
+		t.Error("bad dead letters count:", puts)
+	}
+	// the temporary error after exhausted retries is a dead letter
+	pool = NewPool(Chain(client, Retry(3, time.Millisecond)), 1, responses)
+	defer pool.Close()
+	pool.SetDeadLetterSink(sink)
+	pool.Push(Notification{Payload: `{"aps":{}}`}, "02")
+	if r := <-responses; r.Error == nil {
+		t.Error("no error:", r)
+	}
+	if puts := atomic.LoadInt32(&sink.puts); puts != 1 {
+		t.Error("bad dead letters count:", puts)
+	}
+}
@@ -0,0 +1,383 @@
+package apns
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Pre-encoded header values shared by the requests. The values must not be
+// modified.
+var (
+	headerJSON      = []string{"application/json"}
+	headerUserAgent = []string{"mdigger-apns/3.1"}
+	headerPriority5 = []string{"5"}
+	headerExpireNow = []string{"0"}
+	headerPushTypes = map[string][]string{
+		PushTypeAlert:        {PushTypeAlert},
+		PushTypeBackground:   {PushTypeBackground},
+		PushTypeVoIP:         {PushTypeVoIP},
+		PushTypeComplication: {PushTypeComplication},
+		PushTypeFileProvider: {PushTypeFileProvider},
+		PushTypeMDM:          {PushTypeMDM},
+		PushTypeLiveActivity: {PushTypeLiveActivity},
+		PushTypePushToTalk:   {PushTypePushToTalk},
+	}
+)
+
+// bodyBuffer is the pooled buffer of the request body. The buffer is
+// returned to the pool when all its references are released: the reference
+// of the sender and the references of the body readers closed by the
+// transport.
+type bodyBuffer struct {
+	data []byte
+	refs atomic.Int32
+}
+
+// bodyPool is the pool of the request body buffers.
+var bodyPool = sync.Pool{New: func() interface{} {
+	return &bodyBuffer{data: make([]byte, 0, MaxPayloadSize)}
+}}
+
+// newBodyBuffer returns the empty buffer from the pool with one reference.
+func newBodyBuffer() *bodyBuffer {
+	b := bodyPool.Get().(*bodyBuffer)
+	b.data = b.data[:0]
+	b.refs.Store(1)
+	return b
+}
+
+// release releases the reference to the buffer.
+func (b *bodyBuffer) release() {
+	if b != nil && b.refs.Add(-1) == 0 && cap(b.data) <= 2*MaxVoIPPayloadSize {
+		bodyPool.Put(b)
+	}
+}
+
+// reader returns a new reader of the buffer holding the reference.
+func (b *bodyBuffer) reader() io.ReadCloser {
+	b.refs.Add(1)
+	return &bodyReader{buf: b}
+}
+
+// bodyReader reads the request body from the buffer.
+type bodyReader struct {
+	buf *bodyBuffer
+	off int
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	if r.buf == nil || r.off >= len(r.buf.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.buf.data[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *bodyReader) Close() error {
+	if r.buf != nil {
+		r.buf.release()
+		r.buf = nil
+	}
+	return nil
+}
+
+// hostURL is the parsed URL of the client host.
+type hostURL struct {
+	host string
+	url  *url.URL
+}
+
+// baseURL returns the parsed URL of the client Host, cached until the Host
+// is changed.
+func (c *Client) baseURL() (*url.URL, error) {
+	if base := c.base.Load(); base != nil && base.host == c.Host {
+		return base.url, nil
+	}
+	u, err := url.Parse(c.Host)
+	if err != nil {
+		return nil, err
+	}
+	c.base.Store(&hostURL{host: c.Host, url: u})
+	return u, nil
+}
+
+// authHeader is the authorization header value for the provider token JWT.
+type authHeader struct {
+	jwt   string
+	value []string
+}
+
+// authorization returns the authorization header value with the provider
+// token, cached until the JWT is renewed.
+func (c *Client) authorization() []string {
+	jwt, err := c.token.JWT()
+	if err != nil {
+		return nil
+	}
+	if auth := c.auth.Load(); auth != nil && auth.jwt == jwt {
+		return auth.value
+	}
+	auth := &authHeader{jwt: jwt, value: []string{"bearer " + jwt}}
+	c.auth.Store(auth)
+	return auth.value
+}
+
+// appendBody appends the JSON payload of the notification to dst. The typed
+// Payload is encoded without reflection.
+func (n *Notification) appendBody(dst []byte) ([]byte, error) {
+	switch data := n.Payload.(type) {
+	case []byte:
+		return append(dst, data...), nil
+	case string:
+		return append(dst, data...), nil
+	case json.RawMessage:
+		return append(dst, data...), nil
+	case *Payload:
+		return data.appendJSON(dst)
+	case Payload:
+		return data.appendJSON(dst)
+	default:
+		payload, err := json.Marshal(n.Payload)
+		return append(dst, payload...), err
+	}
+}
+
+// appendJSON appends the payload in JSON format to dst. The keys are sorted
+// like encoding/json does.
+func (p *Payload) appendJSON(dst []byte) ([]byte, error) {
+	var (
+		stack [8]string
+		keys  = append(stack[:0], "aps")
+	)
+	for key := range p.Custom {
+		if key != "aps" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	dst = append(dst, '{')
+	for i, key := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendString(dst, key)
+		dst = append(dst, ':')
+		if key == "aps" {
+			dst = p.APS.appendJSON(dst)
+			continue
+		}
+		var err error
+		if dst, err = appendValue(dst, p.Custom[key]); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// appendJSON appends the aps dictionary in JSON format to dst.
+func (a *APS) appendJSON(dst []byte) []byte {
+	dst = append(dst, '{')
+	var comma bool
+	key := func(name string) {
+		if comma {
+			dst = append(dst, ',')
+		}
+		comma = true
+		dst = append(dst, '"')
+		dst = append(dst, name...)
+		dst = append(dst, '"', ':')
+	}
+	if a.Alert != nil {
+		key("alert")
+		dst = a.Alert.appendJSON(dst)
+	}
+	if a.Badge != nil {
+		key("badge")
+		dst = strconv.AppendInt(dst, int64(*a.Badge), 10)
+	}
+	if a.Sound != "" {
+		key("sound")
+		dst = appendString(dst, a.Sound)
+	}
+	if a.ThreadID != "" {
+		key("thread-id")
+		dst = appendString(dst, a.ThreadID)
+	}
+	if a.Category != "" {
+		key("category")
+		dst = appendString(dst, a.Category)
+	}
+	if a.ContentAvailable {
+		key("content-available")
+		dst = append(dst, '1')
+	}
+	if a.MutableContent {
+		key("mutable-content")
+		dst = append(dst, '1')
+	}
+	if a.InterruptionLevel != "" {
+		key("interruption-level")
+		dst = appendString(dst, a.InterruptionLevel)
+	}
+	return append(dst, '}')
+}
+
+// appendJSON appends the alert in JSON format to dst.
+func (a *Alert) appendJSON(dst []byte) []byte {
+	dst = append(dst, '{')
+	var comma bool
+	field := func(name, value string) {
+		if value == "" {
+			return
+		}
+		if comma {
+			dst = append(dst, ',')
+		}
+		comma = true
+		dst = append(dst, '"')
+		dst = append(dst, name...)
+		dst = append(dst, '"', ':')
+		dst = appendString(dst, value)
+	}
+	args := func(name string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		if comma {
+			dst = append(dst, ',')
+		}
+		comma = true
+		dst = append(dst, '"')
+		dst = append(dst, name...)
+		dst = append(dst, '"', ':', '[')
+		for i, value := range values {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendString(dst, value)
+		}
+		dst = append(dst, ']')
+	}
+	field("title", a.Title)
+	field("subtitle", a.Subtitle)
+	field("body", a.Body)
+	field("title-loc-key", a.TitleLocKey)
+	args("title-loc-args", a.TitleLocArgs)
+	field("subtitle-loc-key", a.SubtitleLocKey)
+	args("subtitle-loc-args", a.SubtitleLocArgs)
+	field("loc-key", a.LocKey)
+	args("loc-args", a.LocArgs)
+	return append(dst, '}')
+}
+
+// appendValue appends the custom value in JSON format to dst. The common
+// types are encoded without reflection.
+func appendValue(dst []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case string:
+		return appendString(dst, v), nil
+	case bool:
+		return strconv.AppendBool(dst, v), nil
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(dst, v, 10), nil
+	case float64:
+		return appendFloat(dst, v)
+	case json.RawMessage:
+		return append(dst, v...), nil
+	case []string:
+		dst = append(dst, '[')
+		for i, s := range v {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendString(dst, s)
+		}
+		return append(dst, ']'), nil
+	default:
+		data, err := json.Marshal(value)
+		return append(dst, data...), err
+	}
+}
+
+// appendFloat appends the number like encoding/json does.
+func appendFloat(dst []byte, f float64) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return dst, &json.UnsupportedValueError{Str: strconv.FormatFloat(f, 'g', -1, 64)}
+	}
+	format, abs := byte('f'), math.Abs(f)
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		if n := len(dst); n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst, nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends the JSON string with the escaping of encoding/json,
+// including the HTML characters.
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= ' ' && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
@@ -0,0 +1,180 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testPayload returns the typed payload used by the encoding tests.
+func testPayload() *Payload {
+	badge := 3
+	return &Payload{
+		APS: APS{
+			Alert: &Alert{Title: "Bob <bob@example.com>", Body: "Tom & Jerry\n\"quoted\" ",
+				LocKey: "MSG", LocArgs: []string{"a", "b"}},
+			Badge: &badge, Sound: "default", ThreadID: "chat-1",
+			MutableContent: true, InterruptionLevel: "time-sensitive",
+		},
+		Custom: map[string]interface{}{
+			"account": "12345678",
+			"aps":     "ignored",
+			"count":   42,
+			"ratio":   0.000001,
+			"big":     1e21,
+			"ok":      true,
+			"none":    nil,
+			"tags":    []string{"x", "y"},
+			"nested":  map[string]interface{}{"a": 1, "b": []interface{}{"c"}},
+			"raw":     json.RawMessage(`{"r":1}`),
+			"bad":     "\xff",
+		},
+	}
+}
+
+func TestPayloadJSON(t *testing.T) {
+	p := testPayload()
+	data, err := p.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reference encoding of the same payload with encoding/json
+	custom := make(map[string]interface{}, len(p.Custom))
+	for key, value := range p.Custom {
+		custom[key] = value
+	}
+	custom["aps"] = map[string]interface{}{
+		"alert":              p.APS.Alert,
+		"badge":              *p.APS.Badge,
+		"sound":              p.APS.Sound,
+		"thread-id":          p.APS.ThreadID,
+		"mutable-content":    1,
+		"interruption-level": p.APS.InterruptionLevel,
+	}
+	want, err := json.Marshal(custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the keys of the aps dictionary and the alert are ordered differently
+	var got, expected interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err, string(data))
+	}
+	json.Unmarshal(want, &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("bad payload:\n%s\n%s", data, want)
+	}
+	// the payload passed by value is encoded the same way
+	if byValue, err := json.Marshal(*p); err != nil || string(byValue) != string(data) {
+		t.Errorf("bad payload by value: %s %v", byValue, err)
+	}
+	body, err := (&Notification{Payload: *p}).appendBody(nil)
+	if err != nil || string(body) != string(data) {
+		t.Errorf("bad notification payload by value: %s %v", body, err)
+	}
+	for _, s := range []string{"", "plain", "<&>", "\x00\x1f\t", " ", "привет 👍", "a\xffb"} {
+		want, _ := json.Marshal(s)
+		if got := appendString(nil, s); string(got) != string(want) {
+			t.Errorf("bad string %q: %s, want %s", s, got, want)
+		}
+	}
+	for _, f := range []float64{0, 1, -1.5, 1e20, 1e21, 1e-6, 1e-7, 123456789.125, -2.5e-10} {
+		want, _ := json.Marshal(f)
+		if got, _ := appendFloat(nil, f); string(got) != string(want) {
+			t.Errorf("bad float %v: %s, want %s", f, got, want)
+		}
+	}
+	if _, err := appendFloat(nil, math.NaN()); err == nil {
+		t.Error("NaN encoded")
+	}
+}
+
+func TestEncodeAllocs(t *testing.T) {
+	p := &Payload{APS: APS{Alert: &Alert{Title: "Hello", Body: "World"},
+		Sound: "default"}, Custom: map[string]interface{}{"id": "42"}}
+	allocs := testing.AllocsPerRun(100, func() {
+		buf := newBodyBuffer()
+		buf.data, _ = p.appendJSON(buf.data)
+		buf.release()
+	})
+	if allocs != 0 {
+		t.Errorf("payload encoding allocates: %v", allocs)
+	}
+
+	client := &Client{Host: ProductionHost}
+	client.token, _ = NewProviderToken("W23G28NPJW", "67XV3VSJ95")
+	if _, err := client.baseURL(); err != nil {
+		t.Fatal(err)
+	}
+	client.token.jwt, client.token.created = "header.claims.signature", time.Now()
+	first := client.authorization()
+	if allocs := testing.AllocsPerRun(100, func() { client.authorization() }); allocs != 0 {
+		t.Errorf("authorization allocates: %v", allocs)
+	}
+	client.token.jwt = "header.claims.renewed"
+	if auth := client.authorization(); auth[0] != "bearer header.claims.renewed" ||
+		&auth[0] == &first[0] {
+		t.Error("authorization is not renewed:", auth)
+	}
+}
+
+func BenchmarkPayloadJSON(b *testing.B) {
+	p := testPayload()
+	delete(p.Custom, "nested")
+	b.Run("append", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := newBodyBuffer()
+			buf.data, _ = p.appendJSON(buf.data)
+			buf.release()
+		}
+	})
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			payload := make(map[string]interface{}, len(p.Custom)+1)
+			for key, value := range p.Custom {
+				payload[key] = value
+			}
+			payload["aps"] = p.APS
+			json.Marshal(payload)
+		}
+	})
+}
+
+func BenchmarkRequest(b *testing.B) {
+	base, _ := url.Parse(ProductionHost)
+	n := Notification{Token: testToken, Topic: "com.example.app",
+		PushType: PushTypeAlert, Expiration: time.Now().Add(time.Hour),
+		Payload: testPayload()}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req, body, err := n.request(base, "/3/device/"+n.Token)
+		if err != nil {
+			b.Fatal(err)
+		}
+		req.Body.Close()
+		body.release()
+	}
+}
+
+func BenchmarkClientSend(b *testing.B) {
+	f := newFakeAPNs(b)
+	client, _ := f.tokenClient(b)
+	n := Notification{Token: testToken, Topic: "com.example.app",
+		Payload: testPayload()}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := client.Send(ctx, n); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package apns
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// EncryptedPayloadKey is the custom payload key of the encrypted envelope.
+const EncryptedPayloadKey = "enc"
+
+// Encrypted payload envelope algorithms.
+const (
+	EncryptionAESGCM = "A256GCM"         // shared AES key
+	EncryptionECDH   = "ECDH-ES+A256GCM" // ephemeral P-256 key agreement
+)
+
+// encryptionVersion is the version of the envelope format.
+const encryptionVersion = 1
+
+// Encryption errors.
+var (
+	ErrEncryptionKey     = errors.New("unknown or unsupported encryption key")
+	ErrEncryptionVersion = errors.New("unsupported encrypted payload version")
+	ErrEncryptionPayload = errors.New("encrypted notification without typed payload")
+)
+
+// EncryptionKey is the per-device key to encrypt the notification payload
+// for the Notification Service Extension of the app. The key is either the
+// AES key shared with the device, or the P-256 public key of the device: the
+// payload is encrypted with the key derived from the ephemeral key agreement.
+//
+// The ID is sent with the encrypted payload, so the extension selects the key
+// to decrypt it. Give the rotated keys new IDs and keep the old ones on the
+// device until the notifications encrypted with them expire.
+type EncryptionKey struct {
+	ID         string           // key identifier known to the device
+	Secret     []byte           // shared AES-256 key: 32 bytes
+	PublicKey  *ecdh.PublicKey  // P-256 public key of the device
+	PrivateKey *ecdh.PrivateKey // P-256 private key of the device to decrypt
+}
+
+// envelope is the encrypted payload envelope.
+type envelope struct {
+	Version   int    `json:"v"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Ephemeral []byte `json:"epk,omitempty"` // ephemeral public key
+	Nonce     []byte `json:"iv"`
+	Data      []byte `json:"ct"` // ciphertext with the tag
+}
+
+// encryptedData is the encrypted content of the payload.
+type encryptedData struct {
+	Alert  *Alert                 `json:"alert,omitempty"`
+	Custom map[string]interface{} `json:"data,omitempty"`
+}
+
+// additionalData returns the authenticated header of the envelope.
+func (e *envelope) additionalData() []byte {
+	data, _ := json.Marshal([]interface{}{e.Version, e.KeyID, e.Algorithm,
+		e.Ephemeral})
+	return data
+}
+
+// deriveKey returns the AES-256 key derived from the ECDH shared secret and
+// the public keys.
+func deriveKey(secret, ephemeral, device []byte) ([]byte, error) {
+	info := append(append([]byte(EncryptionECDH), ephemeral...), device...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// newGCM returns AES-GCM cipher with the key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt returns the notification with the alert and the custom values of
+// the typed Payload encrypted with the key. The payload gets the placeholder
+// alert shown if the extension fails to decrypt the notification in time,
+// and mutable-content to run the extension. The other aps values are sent
+// as is.
+func (k *EncryptionKey) Encrypt(n Notification, placeholder Alert) (
+	Notification, error) {
+	payload, ok := n.typedPayload()
+	if !ok {
+		return n, ErrEncryptionPayload
+	}
+	plaintext, err := json.Marshal(&encryptedData{payload.APS.Alert,
+		payload.Custom})
+	if err != nil {
+		return n, err
+	}
+	var (
+		env = &envelope{Version: encryptionVersion, KeyID: k.ID}
+		key = k.Secret
+	)
+	switch {
+	case len(k.Secret) == 32:
+		env.Algorithm = EncryptionAESGCM
+	case k.PublicKey != nil && k.PublicKey.Curve() == ecdh.P256():
+		env.Algorithm = EncryptionECDH
+		ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+		if err != nil {
+			return n, err
+		}
+		secret, err := ephemeral.ECDH(k.PublicKey)
+		if err != nil {
+			return n, err
+		}
+		env.Ephemeral = ephemeral.PublicKey().Bytes()
+		if key, err = deriveKey(secret, env.Ephemeral, k.PublicKey.Bytes()); err != nil {
+			return n, err
+		}
+	default:
+		return n, ErrEncryptionKey
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return n, err
+	}
+	env.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return n, err
+	}
+	env.Data = gcm.Seal(nil, env.Nonce, plaintext, env.additionalData())
+
+	encrypted := &Payload{APS: payload.APS,
+		Custom: map[string]interface{}{EncryptedPayloadKey: env}}
+	encrypted.APS.Alert = &placeholder
+	encrypted.APS.MutableContent = true
+	n.Payload = encrypted
+	return n, nil
+}
+
+// Decrypt returns the payload with the alert and the custom values decrypted
+// with one of the keys selected by the key ID, like the Notification Service
+// Extension does.
+func Decrypt(data []byte, keys ...*EncryptionKey) (*Payload, error) {
+	var payload struct {
+		Encrypted *envelope `json:"enc"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	env := payload.Encrypted
+	if env == nil || env.Version != encryptionVersion {
+		return nil, ErrEncryptionVersion
+	}
+	var k *EncryptionKey
+	for _, key := range keys {
+		if key.ID == env.KeyID {
+			k = key
+			break
+		}
+	}
+	if k == nil {
+		return nil, ErrEncryptionKey
+	}
+	var key []byte
+	switch {
+	case env.Algorithm == EncryptionAESGCM && len(k.Secret) == 32:
+		key = k.Secret
+	case env.Algorithm == EncryptionECDH && k.PrivateKey != nil:
+		ephemeral, err := ecdh.P256().NewPublicKey(env.Ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := k.PrivateKey.ECDH(ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		if key, err = deriveKey(secret, env.Ephemeral,
+			k.PrivateKey.PublicKey().Bytes()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrEncryptionKey
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != gcm.NonceSize() {
+		return nil, ErrEncryptionVersion
+	}
+	plaintext, err := gcm.Open(nil, env.Nonce, env.Data, env.additionalData())
+	if err != nil {
+		return nil, err
+	}
+	var decrypted encryptedData
+	if err := json.Unmarshal(plaintext, &decrypted); err != nil {
+		return nil, err
+	}
+	return &Payload{APS: APS{Alert: decrypted.Alert},
+		Custom: decrypted.Custom}, nil
+}
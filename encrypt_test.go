@@ -0,0 +1,92 @@
+package apns
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	deviceKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := Notification{Token: testToken, Payload: &Payload{
+		APS: APS{Alert: &Alert{Title: "Bob", Body: "The code is 1234"},
+			Sound: "default"},
+		Custom: map[string]interface{}{"account": "12345678"},
+	}}
+	placeholder := Alert{Title: "New message", Body: "Open the app to read"}
+	f := newFakeAPNs(t)
+	client := f.client(t)
+	for _, key := range []*EncryptionKey{
+		{ID: "k1", Secret: secret},
+		{ID: "k2", PublicKey: deviceKey.PublicKey()},
+	} {
+		encrypted, err := key.Encrypt(n, placeholder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Send(context.Background(), encrypted); err != nil {
+			t.Fatal(err)
+		}
+		_, body := f.last()
+		if strings.Contains(string(body), "1234") {
+			t.Error("payload is not encrypted:", string(body))
+		}
+		var payload struct {
+			APS struct {
+				Alert          Alert  `json:"alert"`
+				Sound          string `json:"sound"`
+				MutableContent int    `json:"mutable-content"`
+			} `json:"aps"`
+		}
+		json.Unmarshal(body, &payload)
+		if payload.APS.MutableContent != 1 || payload.APS.Sound != "default" ||
+			payload.APS.Alert.Body != placeholder.Body {
+			t.Error("bad encrypted payload:", string(body))
+		}
+
+		// the device keeps the old and the new keys
+		keys := []*EncryptionKey{
+			{ID: "k0", Secret: make([]byte, 32)},
+			{ID: "k1", Secret: secret},
+			{ID: "k2", PrivateKey: deviceKey},
+		}
+		decrypted, err := Decrypt(body, keys...)
+		if err != nil {
+			t.Fatal(key.ID, err)
+		}
+		if decrypted.APS.Alert.Body != "The code is 1234" ||
+			decrypted.APS.Alert.Title != "Bob" ||
+			decrypted.Custom["account"] != "12345678" {
+			t.Errorf("bad decrypted payload: %+v", decrypted)
+		}
+		if _, err := Decrypt(body, keys[0]); err != ErrEncryptionKey {
+			t.Error("bad unknown key error:", err)
+		}
+		// tampered key ID
+		tampered := strings.Replace(string(body), `"kid":"`+key.ID,
+			`"kid":"k0`, 1)
+		if _, err := Decrypt([]byte(tampered), keys...); err == nil {
+			t.Error("tampered payload is decrypted")
+		}
+	}
+	if n.Payload.(*Payload).APS.MutableContent {
+		t.Error("source payload is modified")
+	}
+	// the payload value is encrypted as well
+	if _, err := (&EncryptionKey{ID: "k1", Secret: secret}).Encrypt(
+		Notification{Payload: *n.Payload.(*Payload)}, placeholder); err != nil {
+		t.Error("payload value is not encrypted:", err)
+	}
+	if _, err := (&EncryptionKey{ID: "k3", Secret: []byte("short")}).Encrypt(
+		n, placeholder); err != ErrEncryptionKey {
+		t.Error("bad key error:", err)
+	}
+}
@@ -34,6 +34,7 @@ type Error struct {
 	//
 	// List of the possible error codes included in the reason key of a
 	// response's JSON payload:
+	// 	400 BadChannelId - the apns-channel-id of the broadcast is bad.
 	// 	400 BadCollapseId - the collapse identifier exceeds the maximum allowed
 	// 	    size.
 	// 	400 BadDeviceToken - the specified device token was bad. Verify that the
@@ -47,6 +48,7 @@ type Error struct {
 	// 	    specified topic.
 	// 	400 DuplicateHeaders - one or more headers were repeated.
 	// 	400 IdleTimeout - idle time out.
+	// 	400 InvalidPushType - the apns-push-type value is invalid.
 	// 	400 MissingDeviceToken - the device token is not specified in the
 	// 	    request :path. Verify that the :path header contains the device
 	// 	    token.
@@ -69,6 +71,7 @@ type Error struct {
 	// 	    to APNs and Authorization header was missing or no provider token
 	// 	    was specified
 	// 	404 BadPath - the request contained a bad :path value.
+	// 	404 ChannelNotRegistered - the broadcast channel is not registered.
 	// 	405 MethodNotAllowed - the specified :method was not POST.
 	// 	410 Unregistered - the device token is inactive for the specified topic.
 	// 	    Expected HTTP/2 status code is 410; see Table 6-4.
@@ -127,9 +130,38 @@ func (e *Error) IsToken() bool {
 	}
 }
 
+// Temporary returns true if the notification may be delivered after a
+// repeated attempt: the server is overloaded or shutting down, the device
+// token receives too many requests or the connection has been closed.
+func (e *Error) Temporary() bool {
+	switch e.Reason {
+	case "IdleTimeout", "TooManyRequests", "InternalServerError",
+		"ServiceUnavailable", "Shutdown":
+		return true
+	}
+	switch e.Status {
+	case http.StatusInternalServerError, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// Fatal returns true if APNs rejects the credentials of the connection: the
+// certificate is revoked or for the wrong environment, or the provider token
+// is not valid. Repeating the notification with the same credentials fails.
+func (e *Error) Fatal() bool {
+	switch e.Reason {
+	case "BadCertificate", "BadCertificateEnvironment", "Forbidden",
+		"InvalidProviderToken", "MissingProviderToken":
+		return true
+	}
+	return false
+}
+
 // List of the possible error codes included in the reason key of a response's
 // JSON payload:
 var reasons = map[string]string{
+	"BadChannelId":                "The apns-channel-id of the broadcast is bad.",
 	"BadCollapseId":               "The collapse identifier exceeds the maximum allowed size.",
 	"BadDeviceToken":              "The specified device token was bad. Verify that the request contains a valid token and that the token matches the environment.",
 	"BadExpirationDate":           "The apns-expiration value is bad.",
@@ -139,12 +171,14 @@ var reasons = map[string]string{
 	"DeviceTokenNotForTopic":      "The device token does not match the specified topic.",
 	"DuplicateHeaders":            "One or more headers were repeated.",
 	"IdleTimeout":                 "Idle time out.",
+	"InvalidPushType":             "The apns-push-type value is invalid.",
 	"MissingDeviceToken":          "The device token is not specified in the request :path. Verify that the :path header contains the device token.",
 	"MissingTopic":                "The apns-topic header of the request was not specified and was required. The apns-topic header is mandatory when the client is connected using a certificate that supports multiple topics.",
 	"PayloadEmpty":                "The message payload was empty. Expected HTTP/2 :status code is 400.",
 	"TopicDisallowed":             "Pushing to this topic is not allowed.",
 	"BadCertificate":              "The certificate was bad.",
 	"BadCertificateEnvironment":   "The client certificate was for the wrong environment.",
+	"ChannelNotRegistered":        "The broadcast channel is not registered.",
 	"ExpiredProviderToken":        "The provider token is stale and a new token should be generated.",
 	"Forbidden":                   "The specified action is not allowed.",
 	"InvalidProviderToken":        "The provider token is not valid or the token signature could not be verified.",
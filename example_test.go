@@ -1,6 +1,7 @@
 package apns_test
 
 import (
+	"context"
 	"log"
 	"math/rand"
 	"time"
@@ -56,3 +57,22 @@ func Example_jwt() {
 	}
 	log.Println("Sent:", id)
 }
+
+func Example_middleware() {
+	cert, err := apns.LoadCertificate("cert.p12", "xopen123")
+	if err != nil {
+		log.Fatalln("Error loading certificate:", err)
+	}
+	sender := apns.Chain(apns.New(*cert),
+		apns.Logging(nil),
+		apns.Validate,
+		apns.Retry(3, time.Second))
+	result, err := sender.Send(context.Background(), apns.Notification{
+		Token:   `883982D57CDC4138D71E16B5ACBCB5DEBE3E625AFCEEE809A0F32895D2EA9D51`,
+		Payload: `{"aps":{"alert":"Hello!"}}`,
+	})
+	if err != nil {
+		log.Fatalln("Error push:", err)
+	}
+	log.Println("Sent:", result.ID)
+}
@@ -0,0 +1,123 @@
+package apns
+
+import (
+	"net/http"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Truncation reports the alert text trimmed to fit the payload into the size
+// limit: the number of characters (runes) removed from each field.
+type Truncation struct {
+	Title, Subtitle, Body int
+}
+
+// Trimmed returns true if any text was trimmed.
+func (t Truncation) Trimmed() bool {
+	return t.Title > 0 || t.Subtitle > 0 || t.Body > 0
+}
+
+// Fit trims the alert of the notification with the typed Payload to fit it
+// into the maximum payload size for the notification push type, like
+// Payload.Fit does. Other payloads are only checked for the size.
+func (n *Notification) Fit(ellipsis string) (Truncation, error) {
+	if payload, ok := n.typedPayload(); ok {
+		t, err := payload.Fit(n.maxPayloadSize(), ellipsis)
+		if _, ok := n.Payload.(Payload); ok {
+			n.Payload = *payload // keep the trimmed copy of the value
+		}
+		return t, err
+	}
+	data, err := n.body()
+	if err == nil && len(data) > n.maxPayloadSize() {
+		err = &Error{Status: http.StatusRequestEntityTooLarge,
+			Reason: "PayloadTooLarge"}
+	}
+	return Truncation{}, err
+}
+
+// Fit trims the alert texts to fit the payload in JSON format into the limit
+// of bytes: the body first, then the subtitle and the title. The trimmed text
+// ends with the ellipsis, like "…"; the text that does not fit at all is
+// removed. The text is cut between characters only: multibyte characters,
+// combining marks and joined emoji sequences are never split, and the JSON
+// escaping is counted in the size.
+//
+// The alert is replaced by the trimmed copy, so the alerts shared by payloads
+// are kept unchanged. If the payload does not fit without the alert text, the
+// PayloadTooLarge error is returned.
+func (p *Payload) Fit(limit int, ellipsis string) (t Truncation, err error) {
+	var size int
+	fits := func() bool {
+		var data []byte
+		if data, err = p.MarshalJSON(); err != nil {
+			return true // stop on error
+		}
+		size = len(data)
+		return size <= limit
+	}
+	if fits() || err != nil {
+		return t, err
+	}
+	if p.APS.Alert != nil {
+		alert := *p.APS.Alert
+		p.APS.Alert = &alert
+		for _, field := range []struct {
+			text    *string
+			trimmed *int
+		}{
+			{&alert.Body, &t.Body},
+			{&alert.Subtitle, &t.Subtitle},
+			{&alert.Title, &t.Title},
+		} {
+			text := *field.text
+			if text == "" {
+				continue
+			}
+			cuts := cutPoints(text)
+			// the first cut point which does not fit
+			i := sort.Search(len(cuts), func(i int) bool {
+				*field.text = text[:cuts[i]] + ellipsis
+				return !fits()
+			})
+			if err != nil {
+				return t, err
+			}
+			if i > 0 {
+				*field.text = text[:cuts[i-1]] + ellipsis
+				*field.trimmed = utf8.RuneCountInString(text[cuts[i-1]:])
+				return t, nil
+			}
+			*field.text = ""
+			*field.trimmed = utf8.RuneCountInString(text)
+			if fits() || err != nil {
+				return t, err
+			}
+		}
+	}
+	return t, &Error{Status: http.StatusRequestEntityTooLarge,
+		Reason: "PayloadTooLarge"}
+}
+
+// zeroWidthJoiner joins emoji into a single character.
+const zeroWidthJoiner = '\u200d'
+
+// cutPoints returns the byte offsets of the text where it may be cut without
+// splitting a character: before each rune, except the combining marks, emoji
+// modifiers and the runes joined with the zero width joiner.
+func cutPoints(text string) []int {
+	var (
+		cuts = make([]int, 0, len(text))
+		prev rune
+	)
+	for i, r := range text {
+		if prev != zeroWidthJoiner && r != zeroWidthJoiner &&
+			(r < 0x1f3fb || r > 0x1f3ff) && // emoji skin tone modifiers
+			!unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) {
+			cuts = append(cuts, i)
+		}
+		prev = r
+	}
+	return cuts
+}
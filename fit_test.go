@@ -0,0 +1,85 @@
+package apns
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFit(t *testing.T) {
+	alert := &Alert{Title: "Новое сообщение", Subtitle: "Чат",
+		Body: strings.Repeat("Привет, \U0001f44d\U0001f3fd \"мир\" <&> "+
+			"\U0001f468\u200d\U0001f469 e\u0301 ", 100)}
+	payload := &Payload{APS: APS{Alert: alert},
+		Custom: map[string]interface{}{"id": 1}}
+	n := Notification{Token: testToken, Payload: payload}
+	truncation, err := n.Fit("…")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncation.Body == 0 || truncation.Subtitle != 0 || truncation.Title != 0 {
+		t.Error("bad truncation:", truncation)
+	}
+	data, _ := json.Marshal(payload)
+	if len(data) > MaxPayloadSize || len(data) < MaxPayloadSize-64 {
+		t.Error("bad payload size:", len(data))
+	}
+	body := payload.APS.Alert.Body
+	if !utf8.ValidString(body) || !strings.HasSuffix(body, "…") ||
+		!strings.HasPrefix(alert.Body, strings.TrimSuffix(body, "…")) {
+		t.Error("bad trimmed body:", body)
+	}
+	if utf8.RuneCountInString(alert.Body)-truncation.Body !=
+		utf8.RuneCountInString(body)-1 {
+		t.Error("bad trimmed count:", truncation.Body)
+	}
+	if alert.Body == body {
+		t.Error("shared alert is modified")
+	}
+
+	// the payload value is trimmed as well
+	n.Payload = Payload{APS: APS{Alert: alert}}
+	if truncation, err = n.Fit("…"); err != nil || truncation.Body == 0 {
+		t.Fatal("bad value truncation:", truncation, err)
+	}
+	if data, _ := json.Marshal(n.Payload); len(data) > MaxPayloadSize {
+		t.Error("bad value payload size:", len(data))
+	}
+
+	// the body is removed, the subtitle is trimmed
+	payload = &Payload{APS: APS{Alert: &Alert{Title: "Title",
+		Subtitle: strings.Repeat("a", 200), Body: strings.Repeat("b", 200)}},
+		Custom: map[string]interface{}{"data": strings.Repeat("x", 3950)}}
+	if truncation, err = payload.Fit(MaxPayloadSize, ""); err != nil {
+		t.Fatal(err)
+	}
+	if truncation.Body != 200 || truncation.Subtitle == 0 ||
+		truncation.Subtitle == 200 || payload.APS.Alert.Body != "" {
+		t.Error("bad truncation:", truncation, payload.APS.Alert)
+	}
+
+	// the payload does not fit without the alert
+	payload.Custom["data"] = strings.Repeat("x", MaxPayloadSize)
+	if _, err := payload.Fit(MaxPayloadSize, "…"); err == nil {
+		t.Error("too large payload fits")
+	}
+}
+
+func TestCutPoints(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		cuts []int
+	}{
+		{"ab", []int{0, 1}},
+		{"e\u0301!", []int{0, 3}},                     // combining acute accent
+		{"\U0001f44d\U0001f3fd!", []int{0, 8}},        // skin tone modifier
+		{"\U0001f468\u200d\U0001f469!", []int{0, 11}}, // joined emoji
+		{"\u044f!", []int{0, 2}},                      // two-byte rune
+	} {
+		if got := cutPoints(test.text); !reflect.DeepEqual(got, test.cuts) {
+			t.Errorf("bad cut points of %q: %v", test.text, got)
+		}
+	}
+}
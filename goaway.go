@@ -0,0 +1,60 @@
+package apns
+
+import (
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// transportRetries is the number of times the Transport resends the request
+// not processed by the server before the connection was terminated.
+const transportRetries = 3
+
+// GoAway is the connection event of the GOAWAY frame received from APNs: the
+// server terminates the connection for the Reason.
+//
+// The streams above LastStreamID were not processed by APNs, so the Transport
+// resends their notifications with a new connection, unless the reason is
+// Fatal. The streams processed by APNs, but not answered before the
+// connection was closed, fail with the *Error with the Reason.
+type GoAway struct {
+	Reason       string        // reason key of the debug data, e.g. Shutdown
+	Code         http2.ErrCode // HTTP/2 error code
+	LastStreamID uint32        // the last stream processed by APNs
+	Unprocessed  int           // the number of streams to resend
+	Fatal        bool          // the credentials are rejected; see Error.Fatal
+}
+
+// newGoAway returns the event of the GOAWAY error.
+func newGoAway(err http2.GoAwayError, unprocessed int) GoAway {
+	reason := goAwayError(err)
+	return GoAway{
+		Reason:       reason.Reason,
+		Code:         err.ErrCode,
+		LastStreamID: err.LastStreamID,
+		Unprocessed:  unprocessed,
+		Fatal:        reason.Fatal(),
+	}
+}
+
+// goAwayError returns the *Error with the reason of the GOAWAY debug data.
+func goAwayError(err http2.GoAwayError) *Error {
+	e, ok := parseError(0, strings.NewReader(err.DebugData)).(*Error)
+	if !ok {
+		e = &Error{}
+	}
+	return e
+}
+
+// unprocessedError is the error of the stream not processed by the server
+// before the GOAWAY frame.
+type unprocessedError struct {
+	http2.GoAwayError
+}
+
+// goAway reports the GOAWAY event.
+func (c *Client) goAway(event GoAway) {
+	if c.OnGoAway != nil {
+		c.OnGoAway(event)
+	}
+}
@@ -0,0 +1,78 @@
+package apns
+
+import (
+	"sync"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func TestGoAway(t *testing.T) {
+	s := newH2Server(t)
+	var (
+		mu      sync.Mutex
+		first   *h2ServerConn
+		streams []uint32
+	)
+	s.serve = func(c *h2ServerConn, streamID uint32) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = c
+		}
+		if c != first {
+			c.respond(streamID, 200, "")
+			return
+		}
+		// the first connection processes only the first of two streams
+		if streams = append(streams, streamID); len(streams) == 2 {
+			c.fr.WriteGoAway(streams[0], http2.ErrCodeNo, []byte(`{"reason":"Shutdown"}`))
+			c.respond(streams[0], 200, "")
+		}
+	}
+	client := s.client(t)
+	events := make(chan GoAway, 2)
+	client.OnGoAway = func(event GoAway) { events <- event }
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Push(Notification{Token: testToken}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	event := <-events
+	mu.Lock()
+	if event.Reason != "Shutdown" || event.Fatal || event.Unprocessed != 1 ||
+		event.LastStreamID != streams[0] {
+		t.Errorf("bad event: %+v", event)
+	}
+	mu.Unlock()
+	s.mu.Lock()
+	if s.conns != 2 || len(s.headers) != 3 {
+		t.Errorf("bad connections %d and requests %d", s.conns, len(s.headers))
+	}
+	s.mu.Unlock()
+
+	// the rejected certificate stops the retries
+	s.mu.Lock()
+	s.serve = func(c *h2ServerConn, streamID uint32) {
+		c.fr.WriteGoAway(0, http2.ErrCodeNo, []byte(`{"reason":"BadCertificate"}`))
+	}
+	s.mu.Unlock()
+	_, err := client.Push(Notification{Token: testToken})
+	if err, ok := err.(*Error); !ok || err.Reason != "BadCertificate" || !err.Fatal() {
+		t.Fatal("bad error:", err)
+	}
+	if event := <-events; !event.Fatal || event.Reason != "BadCertificate" {
+		t.Errorf("bad event: %+v", event)
+	}
+	s.mu.Lock()
+	if len(s.headers) != 4 {
+		t.Errorf("fatal error retried: %d requests", len(s.headers))
+	}
+	s.mu.Unlock()
+}
@@ -199,9 +199,9 @@ func (pt *ProviderToken) createJWT() (string, error) {
 	if err != nil {
 		panic(err)
 	}
-	copy(buf[120:152], r.Bytes())
-	copy(buf[152:186], s.Bytes())
-	base64.RawURLEncoding.Encode(buf[98:186], buf[120:186])
+	r.FillBytes(buf[120:152])
+	s.FillBytes(buf[152:184])
+	base64.RawURLEncoding.Encode(buf[98:184], buf[120:184])
 	jwt := string(buf)
 	pt.mu.Lock()
 	pt.jwt = jwt
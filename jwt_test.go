@@ -2,8 +2,15 @@ package apns
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"strings"
 	"testing"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -148,3 +155,30 @@ func TestBadJWT(t *testing.T) {
 	}
 
 }
+
+func TestJWTSignatureLength(t *testing.T) {
+	pt, err := NewProviderToken("W23G28NPJW", "67XV3VSJ95")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt.privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	// r or s shorter than 32 bytes happens once in about 128 signatures
+	for i := 0; i < 2000; i++ {
+		token, err := pt.createJWT()
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := strings.LastIndexByte(token, '.')
+		sign, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+		if err != nil || len(sign) != 64 {
+			t.Fatalf("bad signature: %s %v", token, err)
+		}
+		sum := sha256.Sum256([]byte(token[:i]))
+		r, s := new(big.Int).SetBytes(sign[:32]), new(big.Int).SetBytes(sign[32:])
+		if !ecdsa.Verify(&pt.privateKey.PublicKey, sum[:], r, s) {
+			t.Fatal("signature is not verified:", token)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package apns
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Keepalive errors.
+var (
+	ErrPingTimeout     = errors.New("apns connection ping timeout")
+	ErrPingUnsupported = errors.New("apns ping is not supported by the transport")
+)
+
+// SetKeepAlive sets the interval of the HTTP/2 PING frames checking the
+// health of the connections and the timeout of their acknowledgement. The
+// connection failed the check is closed, so the next notification is sent
+// with the new connection without waiting for the dead one. The zero
+// interval disables the checks; the zero timeout is Timeout.
+//
+// The net/http transport pings the connections idle for the interval; the
+// Transport pings all connections with the interval. The settings are
+// applied to the new connections. The net/http transport reads the settings
+// without locking, so with it call SetKeepAlive before sending notifications;
+// the Transport set with EnableHPACK may be changed at any time.
+func (c *Client) SetKeepAlive(interval, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = Timeout
+	}
+	switch t := c.httpСlient.Transport.(type) {
+	case *Transport:
+		t.mu.Lock()
+		t.PingInterval, t.PingTimeout = interval, timeout
+		t.mu.Unlock()
+	default:
+		if c.h2 != nil {
+			c.h2.ReadIdleTimeout, c.h2.PingTimeout = interval, timeout
+		}
+	}
+}
+
+// Ping checks the connection to APNs with the HTTP/2 PING frame without
+// sending a notification, for example, for the readiness probe of the
+// service. The Transport pings its pooled connection to the Host,
+// establishing it if necessary.
+//
+// The net/http transport does not expose its connections, so with it Ping
+// establishes a separate new connection, pings it and closes it: it checks
+// that APNs is reachable, not the health of the connections used for the
+// notifications.
+func (c *Client) Ping(ctx context.Context) error {
+	base, err := c.baseURL()
+	if err != nil {
+		return err
+	}
+	addr := hostAddr(base)
+	switch t := c.httpСlient.Transport.(type) {
+	case *Transport:
+		proxy, err := requestProxy(t.Proxy, base)
+		if err != nil {
+			return err
+		}
+		cc, err := t.conn(ctx, addr, proxy)
+		if err != nil {
+			return err
+		}
+		cc.release()
+		return cc.ping(ctx)
+	case *http.Transport:
+		proxy, err := requestProxy(t.Proxy, base)
+		if err != nil {
+			return err
+		}
+		conn, err := dialTLS(ctx, t.TLSClientConfig, proxy, addr)
+		if err != nil {
+			return err
+		}
+		cc, err := new(http2.Transport).NewClientConn(conn)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		defer cc.Close()
+		return cc.Ping(ctx)
+	default:
+		return ErrPingUnsupported
+	}
+}
+
+// release releases the stream reserved for the request.
+func (cc *transportConn) release() {
+	cc.mu.Lock()
+	cc.reserved--
+	cc.mu.Unlock()
+}
+
+// ping sends the PING frame and waits for its acknowledgement.
+func (cc *transportConn) ping(ctx context.Context) error {
+	var data [8]byte
+	if _, err := rand.Read(data[:]); err != nil {
+		return err
+	}
+	ack := make(chan struct{})
+	cc.mu.Lock()
+	if cc.err != nil {
+		err := cc.err
+		cc.mu.Unlock()
+		return err
+	}
+	cc.pings[data] = ack
+	cc.mu.Unlock()
+	if err := cc.write(func() error { return cc.fr.WritePing(false, data) }); err != nil {
+		cc.close(err)
+		return err
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-cc.closed:
+		cc.mu.Lock()
+		defer cc.mu.Unlock()
+		return cc.err
+	case <-ctx.Done():
+		cc.mu.Lock()
+		delete(cc.pings, data)
+		cc.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// keepAlive pings the connection with the interval and closes it if the
+// acknowledgement is not received in time.
+func (cc *transportConn) keepAlive(interval, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = Timeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cc.closed:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := cc.ping(ctx)
+		cancel()
+		if err == context.DeadlineExceeded {
+			cc.close(ErrPingTimeout)
+			return
+		}
+	}
+}
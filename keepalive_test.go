@@ -0,0 +1,63 @@
+package apns
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKeepAlive(t *testing.T) {
+	s := newH2Server(t)
+	client := s.client(t)
+	client.SetKeepAlive(10*time.Millisecond, 30*time.Millisecond)
+	if err := client.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Push(Notification{Token: testToken}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	s.mu.Lock()
+	pings := s.pings
+	s.noAck = true
+	s.mu.Unlock()
+	if pings == 0 {
+		t.Error("pings are not sent")
+	}
+
+	// the unhealthy connection is closed
+	transport := client.httpСlient.Transport.(*Transport)
+	for start := time.Now(); ; time.Sleep(5 * time.Millisecond) {
+		transport.mu.Lock()
+		n := len(transport.conns)
+		transport.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("unhealthy connection is not closed")
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.Ping(ctx); err != context.DeadlineExceeded {
+		t.Error("bad ping error:", err)
+	}
+	s.mu.Lock()
+	s.noAck = false
+	s.mu.Unlock()
+	if _, err := client.Push(Notification{Token: testToken}); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	if s.conns < 2 {
+		t.Error("connection is not reestablished")
+	}
+	s.mu.Unlock()
+
+	// the net/http transport
+	f := newFakeAPNs(t)
+	if err := f.client(t).Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,133 @@
+package apns
+
+import "reflect"
+
+// Lane describes a priority lane of the pool.
+//
+// Notifications from the higher priority lanes are sent first. To keep the
+// lower priority lanes from starving while the higher ones are busy, each lane
+// gets the share of the dequeued notifications proportional to its Weight.
+type Lane struct {
+	Weight int // share of the dequeued notifications; at least 1
+	Depth  int // maximum number of queued notifications in the lane
+}
+
+// NewPriorityPool returns a pool of workers sending notifications queued in
+// several priority lanes, from the highest priority to the lowest one. Push
+// selects the lane by the notification priority: the highest lane for the
+// regular notifications and the lowest lane for the notifications with
+// LowPriority. Use PushLane to select the lane explicitly.
+//
+// Without lanes, the pool has a single unbuffered lane, just like NewPool.
+func NewPriorityPool(sender Sender, workers uint, responses chan<- Response,
+	lanes ...Lane) *ClientsPool {
+	if len(lanes) == 0 {
+		lanes = []Lane{{Weight: 1}}
+	}
+	p := &ClientsPool{
+		sender:    sender,
+		lanes:     make([]chan poolItem, len(lanes)),
+		responses: responses,
+		quit:      make(chan struct{}),
+	}
+	for i, lane := range lanes {
+		p.lanes[i] = make(chan poolItem, lane.Depth)
+	}
+	if len(lanes) == 1 {
+		p.notifications = p.lanes[0]
+	} else {
+		p.notifications = make(chan poolItem)
+		go p.dispatch(lanes)
+	}
+	p.scheduler = &scheduler{pool: p}
+	if p.client = baseClient(sender); p.client != nil {
+		p.breaker = p.client.Breaker
+	}
+	// startup workers to send notifications
+	for i := uint(0); i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// laneOf returns the lane for the notification by its priority.
+func (p *ClientsPool) laneOf(n Notification) int {
+	if n.LowPriority {
+		return len(p.lanes) - 1
+	}
+	return 0
+}
+
+// dispatch moves the notifications from the lanes to the workers.
+//
+// The lanes are visited in the weighted round-robin order: each turn prefers
+// one lane, and the lane is preferred Weight times per round. If the preferred
+// lane is empty, the notification is taken from the highest non-empty lane.
+func (p *ClientsPool) dispatch(lanes []Lane) {
+	var (
+		order     []int // preferred lane for each turn of the round
+		weights   = make([]int, len(lanes))
+		maxWeight = 1
+	)
+	for i, lane := range lanes {
+		if weights[i] = lane.Weight; weights[i] < 1 {
+			weights[i] = 1
+		}
+		if weights[i] > maxWeight {
+			maxWeight = weights[i]
+		}
+	}
+	// interleave the turns of the lower lanes with the higher ones
+	for pass := 0; pass < maxWeight; pass++ {
+		for i, weight := range weights {
+			if pass < weight {
+				order = append(order, i)
+			}
+		}
+	}
+	var (
+		open  = len(p.lanes)
+		cases = make([]reflect.SelectCase, len(p.lanes))
+	)
+	for i, lane := range p.lanes {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv,
+			Chan: reflect.ValueOf(lane)}
+	}
+	for turn := 0; open > 0; turn++ {
+		item, ok := p.take(order[turn%len(order)])
+		if !ok {
+			// all lanes are empty: wait for any notification
+			chosen, value, received := reflect.Select(cases)
+			if !received {
+				cases[chosen].Chan = reflect.Value{} // closed lane
+				open--
+				continue
+			}
+			item = value.Interface().(poolItem)
+		}
+		p.notifications <- item
+	}
+	close(p.notifications)
+}
+
+// take returns the notification from the preferred lane or, if it is empty,
+// from the highest non-empty lane without blocking.
+func (p *ClientsPool) take(preferred int) (poolItem, bool) {
+	select {
+	case item, ok := <-p.lanes[preferred]:
+		if ok {
+			return item, true
+		}
+	default:
+	}
+	for _, lane := range p.lanes {
+		select {
+		case item, ok := <-lane:
+			if ok {
+				return item, true
+			}
+		default:
+		}
+	}
+	return poolItem{}, false
+}
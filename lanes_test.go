@@ -0,0 +1,70 @@
+package apns
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestPriorityPool(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		order []string
+		gate  = make(chan struct{})
+	)
+	sender := SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+		<-gate
+		mu.Lock()
+		order = append(order, n.Topic)
+		mu.Unlock()
+		return Result{Token: n.Token}, nil
+	})
+	responses := make(chan Response, 20)
+	pool := NewPriorityPool(sender, 1, responses,
+		Lane{Weight: 3, Depth: 10}, Lane{Weight: 1, Depth: 10})
+	defer pool.Close()
+	// the first notification occupies the worker
+	pool.Push(Notification{Topic: "first"}, "00")
+	low := Notification{Topic: "low", LowPriority: true}
+	pool.Push(low, "01", "02", "03", "04")
+	high := Notification{Topic: "high"}
+	pool.Push(high, "05", "06", "07", "08", "09", "10")
+	close(gate)
+	for i := 0; i < 11; i++ {
+		<-responses
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// the dispatcher holds one notification while the worker is busy
+	var lows, highs int
+	for _, topic := range order[2:6] {
+		switch topic {
+		case "low":
+			lows++
+		case "high":
+			highs++
+		}
+	}
+	if highs != 3 || lows != 1 {
+		t.Error("bad weighted order:", order)
+	}
+	if order[len(order)-1] != "low" {
+		t.Error("high priority notifications are not sent first:", order)
+	}
+}
+
+func TestPriorityPoolLane(t *testing.T) {
+	sender := new(countSender)
+	responses := make(chan Response, 3)
+	pool := NewPriorityPool(sender, 2, responses, Lane{}, Lane{}, Lane{})
+	defer pool.Close()
+	pool.PushLane(1, Notification{}, "01")
+	pool.PushLane(5, Notification{}, "02")
+	pool.PushLane(-1, Notification{}, "03")
+	for i := 0; i < 3; i++ {
+		<-responses
+	}
+	if sender.sent() != 3 {
+		t.Error("bad sent count:", sender.sent())
+	}
+}
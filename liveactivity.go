@@ -0,0 +1,147 @@
+package apns
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Live Activity events.
+const (
+	LiveActivityStart  = "start"  // push-to-start a new Live Activity
+	LiveActivityUpdate = "update" // update the content of the Live Activity
+	LiveActivityEnd    = "end"    // end the Live Activity
+)
+
+// LiveActivityTopicSuffix is added to the bundle ID of the app to form the
+// topic of the Live Activity notifications.
+const LiveActivityTopicSuffix = ".push-type.liveactivity"
+
+// Live Activity payload errors.
+var (
+	ErrLiveActivityEvent        = errors.New("bad live activity event")
+	ErrLiveActivityContentState = errors.New("missing live activity content-state")
+	ErrLiveActivityAttributes   = errors.New("missing live activity attributes")
+	ErrLiveActivityDismissal    = errors.New("dismissal-date is allowed only for the end event")
+	ErrLiveActivityTimestamp    = errors.New("missing live activity timestamp")
+)
+
+// LiveActivityAlert is the alert shown when the Live Activity starts or is
+// updated.
+type LiveActivityAlert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Sound string `json:"sound,omitempty"`
+}
+
+// LiveActivity is the payload of the notification starting, updating or
+// ending the Live Activity of the app. Use it as the Notification Payload or
+// get the ready notification with the Notification method.
+//
+// The Timestamp tells the system the order of the updates: the updates older
+// than the current content of the Live Activity are ignored. It is required
+// for the payload and set to the current time by the Notification method, if
+// zero. The ContentState
+// must match the ContentState type of the activity attributes in the app, and
+// is required for the start and update events. The start event also requires
+// the AttributesType and the Attributes of the new activity.
+type LiveActivity struct {
+	Event          string             // start, update or end
+	Timestamp      time.Time          // time of the content
+	ContentState   interface{}        // dynamic content of the activity
+	StaleDate      time.Time          // when the content becomes outdated
+	DismissalDate  time.Time          // when to remove the ended activity
+	RelevanceScore float64            // priority among the app activities
+	AttributesType string             // attributes type name for start event
+	Attributes     interface{}        // static attributes for start event
+	Alert          *LiveActivityAlert // alert to show the user
+}
+
+// jsonLiveActivity is the aps dictionary of the Live Activity payload.
+type jsonLiveActivity struct {
+	Event          string             `json:"event"`
+	Timestamp      int64              `json:"timestamp"`
+	ContentState   interface{}        `json:"content-state,omitempty"`
+	StaleDate      int64              `json:"stale-date,omitempty"`
+	DismissalDate  int64              `json:"dismissal-date,omitempty"`
+	RelevanceScore float64            `json:"relevance-score,omitempty"`
+	AttributesType string             `json:"attributes-type,omitempty"`
+	Attributes     interface{}        `json:"attributes,omitempty"`
+	Alert          *LiveActivityAlert `json:"alert,omitempty"`
+}
+
+// unixTime returns the UNIX time or zero for the zero time.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// MarshalJSON returns the payload of the Live Activity notification.
+func (a LiveActivity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]*jsonLiveActivity{"aps": {
+		Event:          a.Event,
+		Timestamp:      unixTime(a.Timestamp),
+		ContentState:   a.ContentState,
+		StaleDate:      unixTime(a.StaleDate),
+		DismissalDate:  unixTime(a.DismissalDate),
+		RelevanceScore: a.RelevanceScore,
+		AttributesType: a.AttributesType,
+		Attributes:     a.Attributes,
+		Alert:          a.Alert,
+	}})
+}
+
+// Validate checks the Live Activity fields by the event.
+func (a LiveActivity) Validate() error {
+	switch a.Event {
+	case LiveActivityStart:
+		if a.AttributesType == "" || a.Attributes == nil {
+			return ErrLiveActivityAttributes
+		}
+		fallthrough
+	case LiveActivityUpdate:
+		if a.ContentState == nil {
+			return ErrLiveActivityContentState
+		}
+		if !a.DismissalDate.IsZero() {
+			return ErrLiveActivityDismissal
+		}
+	case LiveActivityEnd:
+	default:
+		return ErrLiveActivityEvent
+	}
+	if a.Timestamp.IsZero() {
+		return ErrLiveActivityTimestamp
+	}
+	return nil
+}
+
+// Notification returns the notification to the device with the Live Activity
+// push token. The push type and the topic with the LiveActivityTopicSuffix
+// are set by the bundle ID of the app.
+//
+// The notification is sent with the high priority only for the start event
+// and for the alerting updates: the high priority updates are limited by the
+// system budget, so the silent updates are sent with the low priority.
+func (a LiveActivity) Notification(token, bundleID string) (Notification, error) {
+	if a.Timestamp.IsZero() {
+		a.Timestamp = time.Now()
+	}
+	n := Notification{
+		Token:       token,
+		Topic:       bundleID,
+		PushType:    PushTypeLiveActivity,
+		LowPriority: a.Event != LiveActivityStart && a.Alert == nil,
+		Payload:     a,
+	}
+	if !strings.HasSuffix(n.Topic, LiveActivityTopicSuffix) {
+		n.Topic += LiveActivityTopicSuffix
+	}
+	if err := a.Validate(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
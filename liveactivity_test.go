@@ -0,0 +1,118 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLiveActivity(t *testing.T) {
+	f := newFakeAPNs(t)
+	client := Chain(f.client(t), Validate)
+	now := time.Unix(1700000000, 0)
+	activity := &LiveActivity{
+		Event:          LiveActivityStart,
+		Timestamp:      now,
+		ContentState:   map[string]int{"score": 1},
+		StaleDate:      now.Add(time.Hour),
+		RelevanceScore: 50,
+		AttributesType: "MatchAttributes",
+		Attributes:     map[string]string{"team": "Blue"},
+		Alert:          &LiveActivityAlert{Title: "Match", Body: "Started"},
+	}
+	n, err := activity.Notification(testToken, "com.example.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	r, body := f.last()
+	if r.Header.Get("apns-topic") != "com.example.app.push-type.liveactivity" ||
+		r.Header.Get("apns-push-type") != PushTypeLiveActivity ||
+		r.Header.Get("apns-priority") != "" {
+		t.Error("bad headers:", r.Header)
+	}
+	var payload struct {
+		APS map[string]interface{} `json:"aps"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]interface{}{
+		"event":           "start",
+		"timestamp":       float64(now.Unix()),
+		"stale-date":      float64(now.Add(time.Hour).Unix()),
+		"relevance-score": float64(50),
+		"attributes-type": "MatchAttributes",
+	} {
+		if payload.APS[key] != value {
+			t.Errorf("bad %s: %v", key, payload.APS[key])
+		}
+	}
+	if _, ok := payload.APS["dismissal-date"]; ok {
+		t.Error("unexpected dismissal-date")
+	}
+
+	// the payload value is encoded like the pointer
+	n.Payload = *activity
+	if _, err := client.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if _, value := f.last(); string(value) != string(body) {
+		t.Errorf("bad value payload: %s", value)
+	}
+	// the zero timestamp is set once by the notification
+	end, err := LiveActivity{Event: LiveActivityEnd}.Notification(testToken,
+		"com.example.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end.Payload.(LiveActivity).Timestamp.IsZero() {
+		t.Error("timestamp is not set")
+	}
+
+	// silent update is sent with the low priority
+	update := &LiveActivity{Event: LiveActivityUpdate,
+		ContentState: map[string]int{"score": 2}}
+	if n, err = update.Notification(testToken, "com.example.app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := f.last(); r.Header.Get("apns-priority") != "5" {
+		t.Error("bad update priority:", r.Header.Get("apns-priority"))
+	}
+
+	for _, test := range []struct {
+		activity *LiveActivity
+		err      error
+	}{
+		{&LiveActivity{Event: "pause"}, ErrLiveActivityEvent},
+		{&LiveActivity{Event: LiveActivityUpdate}, ErrLiveActivityContentState},
+		{&LiveActivity{Event: LiveActivityStart, ContentState: 1},
+			ErrLiveActivityAttributes},
+		{&LiveActivity{Event: LiveActivityUpdate, ContentState: 1,
+			DismissalDate: now}, ErrLiveActivityDismissal},
+		{&LiveActivity{Event: LiveActivityEnd, DismissalDate: now}, nil},
+	} {
+		if _, err := test.activity.Notification(testToken, "com.example.app"); err != test.err {
+			t.Errorf("bad error for %v: %v", test.activity.Event, err)
+		}
+	}
+	count := f.count()
+	n.Payload = &LiveActivity{Event: LiveActivityUpdate}
+	if _, err := client.Send(context.Background(), n); err != ErrLiveActivityContentState {
+		t.Error("bad validation error:", err)
+	}
+	// the payload value is validated as well and requires the timestamp
+	n.Payload = LiveActivity{Event: LiveActivityEnd}
+	if _, err := client.Send(context.Background(), n); err != ErrLiveActivityTimestamp {
+		t.Error("bad validation error:", err)
+	}
+	if f.count() != count {
+		t.Error("invalid notification is sent")
+	}
+}
@@ -0,0 +1,377 @@
+package apns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// ErrLocalization is returned when the localization key of the alert is not
+// found in the catalog for the locale and its fallbacks.
+var ErrLocalization = errors.New("missing localization key")
+
+// Catalog is the server-side localization catalog: the alert strings by
+// locale. It localizes the alerts with localization keys for the devices
+// whose app bundle lacks the strings of their locale.
+//
+// The strings are looked up by the locale with the fallback by the language
+// tag: pt-BR, then pt, then the Fallback locale.
+type Catalog struct {
+	Fallback   string   // the last fallback locale; en by default
+	AppLocales []string // locales localized by the app bundle
+
+	mu      sync.RWMutex
+	strings map[string]map[string]string // by locale and key
+}
+
+// NewCatalog returns an empty catalog with the en fallback locale.
+func NewCatalog() *Catalog {
+	return &Catalog{Fallback: "en", strings: make(map[string]map[string]string)}
+}
+
+// normalizeLocale returns the locale in the lower case with the hyphens.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+// fallbacks returns the locales to look up for the locale.
+func (c *Catalog) fallbacks(locale string) []string {
+	var locales []string
+	for locale = normalizeLocale(locale); locale != ""; {
+		locales = append(locales, locale)
+		i := strings.LastIndexByte(locale, '-')
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	if c.Fallback != "" {
+		locales = append(locales, normalizeLocale(c.Fallback))
+	}
+	return locales
+}
+
+// Add adds the strings of the locale to the catalog.
+func (c *Catalog) Add(locale string, values map[string]string) {
+	locale = normalizeLocale(locale)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.strings == nil {
+		c.strings = make(map[string]map[string]string)
+	}
+	if c.strings[locale] == nil {
+		c.strings[locale] = make(map[string]string, len(values))
+	}
+	for key, value := range values {
+		c.strings[locale][key] = value
+	}
+}
+
+// Lookup returns the string of the key for the locale or its fallbacks.
+func (c *Catalog) Lookup(locale, key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, locale := range c.fallbacks(locale) {
+		if value, ok := c.strings[locale][key]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Format returns the string of the key for the locale formatted with the
+// localization arguments like the device does: %@ and the positional %1$@
+// specifiers are replaced by the arguments, %% by the percent sign.
+func (c *Catalog) Format(locale, key string, args []string) (string, error) {
+	format, ok := c.Lookup(locale, key)
+	if !ok {
+		return "", ErrLocalization
+	}
+	return formatLoc(format, args), nil
+}
+
+// formatLoc replaces the format specifiers with the arguments.
+func formatLoc(format string, args []string) string {
+	var (
+		buf  strings.Builder
+		next int // the next sequential argument
+	)
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			buf.WriteByte(format[i])
+			continue
+		}
+		i++
+		if format[i] == '%' {
+			buf.WriteByte('%')
+			continue
+		}
+		// the optional position, flags and width before the conversion
+		start, arg := i, -1
+		for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+			i++
+		}
+		if i < len(format) && format[i] == '$' && i > start {
+			n, _ := strconv.Atoi(format[start:i])
+			arg = n - 1
+			i++
+		}
+		for i < len(format) && strings.IndexByte("0123456789.-+ #lhqzt", format[i]) >= 0 {
+			i++
+		}
+		if arg < 0 {
+			arg = next
+			next++
+		}
+		if arg < len(args) {
+			buf.WriteString(args[arg])
+		}
+	}
+	return buf.String()
+}
+
+// Localize returns the notification with the alert localized for the
+// locale of the recipient. If the app bundle is localized for the locale, the
+// localization keys are sent to the device as is. Otherwise the keys are
+// replaced by the texts rendered with the catalog.
+//
+// Only the notification with the typed Payload is localized; the payload and
+// its alert are copied, not modified.
+func (c *Catalog) Localize(n Notification, locale string) (Notification, error) {
+	payload, ok := n.typedPayload()
+	if !ok || payload.APS.Alert == nil || c.appLocalized(locale) {
+		return n, nil
+	}
+	var (
+		localized = *payload
+		alert     = *payload.APS.Alert
+		err       error
+	)
+	for _, field := range []struct {
+		text *string
+		key  *string
+		args *[]string
+	}{
+		{&alert.Title, &alert.TitleLocKey, &alert.TitleLocArgs},
+		{&alert.Subtitle, &alert.SubtitleLocKey, &alert.SubtitleLocArgs},
+		{&alert.Body, &alert.LocKey, &alert.LocArgs},
+	} {
+		if *field.key == "" {
+			continue
+		}
+		if *field.text, err = c.Format(locale, *field.key, *field.args); err != nil {
+			return n, fmt.Errorf("%w: %s", err, *field.key)
+		}
+		*field.key, *field.args = "", nil
+	}
+	localized.APS.Alert = &alert
+	n.Payload = &localized
+	return n, nil
+}
+
+// appLocalized returns true if the app bundle has the strings of the locale
+// or of its language.
+func (c *Catalog) appLocalized(locale string) bool {
+	locales := c.fallbacks(locale)
+	if c.Fallback != "" {
+		locales = locales[:len(locales)-1]
+	}
+	for _, locale := range locales {
+		for _, app := range c.AppLocales {
+			if normalizeLocale(app) == locale {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoadJSON adds the strings of the locale from the JSON object with the
+// string values.
+func (c *Catalog) LoadJSON(locale string, r io.Reader) error {
+	var values map[string]string
+	if err := json.NewDecoder(r).Decode(&values); err != nil {
+		return err
+	}
+	c.Add(locale, values)
+	return nil
+}
+
+// LoadStrings adds the strings of the locale from the Apple .strings file
+// in UTF-8 or UTF-16 with the byte order mark:
+//
+//	/* comment */
+//	"key" = "value";
+func (c *Catalog) LoadStrings(locale string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := parseStrings(decodeUTF16(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", locale, err)
+	}
+	c.Add(locale, values)
+	return nil
+}
+
+// LoadDir adds the strings from the files of the directory: <locale>.json,
+// <locale>.strings and <locale>.lproj/Localizable.strings.
+func (c *Catalog) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		var (
+			name   = filepath.Join(dir, entry.Name())
+			ext    = filepath.Ext(entry.Name())
+			locale = strings.TrimSuffix(entry.Name(), ext)
+			load   func(string, io.Reader) error
+		)
+		switch {
+		case entry.IsDir() && ext == ".lproj":
+			name, load = filepath.Join(name, "Localizable.strings"), c.LoadStrings
+		case entry.IsDir():
+			continue
+		case ext == ".json":
+			load = c.LoadJSON
+		case ext == ".strings":
+			load = c.LoadStrings
+		default:
+			continue
+		}
+		if err := loadFile(name, locale, load); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFile loads the strings of the locale from the file.
+func loadFile(name, locale string, load func(string, io.Reader) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return load(locale, file)
+}
+
+// decodeUTF16 returns the UTF-8 text of the UTF-16 data with the byte order
+// mark or the data itself.
+func decodeUTF16(data []byte) []byte {
+	var bigEndian bool
+	switch {
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		bigEndian = true
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+	default:
+		return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	}
+	units := make([]uint16, 0, len(data)/2-1)
+	for i := 2; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// parseStrings parses the "key" = "value"; pairs of the .strings file.
+func parseStrings(data []byte) (map[string]string, error) {
+	var (
+		values = make(map[string]string)
+		tokens []string // key, "=", value, ";"
+		text   = string(data)
+	)
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 4
+		case strings.HasPrefix(text[i:], "//"):
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text) - i
+			}
+			i += end
+		case c == '=' || c == ';':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			value, n, err := unquoteStrings(text[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, value)
+			i += n
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+		if len(tokens) == 4 {
+			if tokens[1] != "=" || tokens[3] != ";" {
+				return nil, fmt.Errorf("bad string definition %q", tokens[0])
+			}
+			values[tokens[0]] = tokens[2]
+			tokens = tokens[:0]
+		}
+	}
+	if len(tokens) > 0 {
+		return nil, errors.New("unterminated string definition")
+	}
+	return values, nil
+}
+
+// unquoteStrings returns the value of the quoted string at the start of the
+// text and the length of the quoted string.
+func unquoteStrings(text string) (string, int, error) {
+	var buf strings.Builder
+	for i := 1; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '"':
+			return buf.String(), i + 1, nil
+		case '\\':
+			if i++; i == len(text) {
+				break
+			}
+			switch text[i] {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			case 'U', 'u':
+				if i+4 < len(text) {
+					if r, err := strconv.ParseUint(text[i+1:i+5], 16, 16); err == nil {
+						buf.WriteRune(rune(r))
+						i += 4
+						continue
+					}
+				}
+				buf.WriteByte(text[i])
+			default:
+				buf.WriteByte(text[i])
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated quoted string")
+}
@@ -0,0 +1,90 @@
+package apns
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"en.json": `{"NEW_MESSAGE": "New message from %@", "TITLE": "Chat"}`,
+		"pt.strings": "/* Portuguese */\n\"NEW_MESSAGE\" = \"Nova mensagem de %@\";\n" +
+			"// title\n\"TITLE\" = \"Bate-papo \\\"%1$@\\\" 100%%\";\n",
+		"ru.lproj/Localizable.strings": "\xef\xbb\xbf\"NEW_MESSAGE\" = \"Сообщение от %@\";",
+	} {
+		name = filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(name), 0700)
+		if err := os.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	catalog := NewCatalog()
+	catalog.AppLocales = []string{"en", "de"}
+	if err := catalog.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	n := Notification{Payload: &Payload{APS: APS{Alert: &Alert{
+		TitleLocKey: "TITLE", TitleLocArgs: []string{"Team"},
+		LocKey: "NEW_MESSAGE", LocArgs: []string{"Bob"},
+	}}}}
+	for locale, alert := range map[string]Alert{
+		"pt-BR": {Title: `Bate-papo "Team" 100%`, Body: "Nova mensagem de Bob"},
+		"ru_RU": {Title: "Chat", Body: "Сообщение от Bob"},
+		"fr":    {Title: "Chat", Body: "New message from Bob"},
+	} {
+		localized, err := catalog.Localize(n, locale)
+		if err != nil {
+			t.Fatal(locale, err)
+		}
+		got := localized.Payload.(*Payload).APS.Alert
+		if got.Title != alert.Title || got.Body != alert.Body ||
+			got.LocKey != "" || got.TitleLocArgs != nil {
+			t.Errorf("bad %s alert: %+v", locale, got)
+		}
+	}
+	// the app bundle is localized: the keys are sent
+	for _, locale := range []string{"en-US", "de"} {
+		localized, err := catalog.Localize(n, locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alert := localized.Payload.(*Payload).APS.Alert; alert.LocKey != "NEW_MESSAGE" ||
+			alert.Body != "" {
+			t.Errorf("bad %s alert: %+v", locale, alert)
+		}
+	}
+	if n.Payload.(*Payload).APS.Alert.Body != "" {
+		t.Error("source alert is modified")
+	}
+	// the payload value is localized as well
+	localized, err := catalog.Localize(Notification{Payload: *n.Payload.(*Payload)}, "fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert := localized.Payload.(*Payload).APS.Alert; alert.Body != "New message from Bob" {
+		t.Errorf("bad value alert: %+v", alert)
+	}
+	n.Payload.(*Payload).APS.Alert.LocKey = "UNKNOWN"
+	if _, err := catalog.Localize(n, "pt"); !errors.Is(err, ErrLocalization) {
+		t.Error("bad missing key error:", err)
+	}
+
+	if err := catalog.LoadStrings("es", strings.NewReader(`"KEY" = "value"`)); err == nil {
+		t.Error("bad strings file is loaded")
+	}
+	// UTF-16 little endian with the byte order mark
+	utf16 := []byte{0xff, 0xfe}
+	for _, r := range `"K"="Ñ";` {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+	if err := catalog.LoadStrings("es", strings.NewReader(string(utf16))); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := catalog.Lookup("es-MX", "K"); value != "Ñ" {
+		t.Error("bad UTF-16 string:", value)
+	}
+}
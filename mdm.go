@@ -0,0 +1,27 @@
+package apns
+
+import "strings"
+
+// MDMTopicPrefix is the prefix of the topic of the Mobile Device Management
+// (MDM) push certificate.
+const MDMTopicPrefix = "com.apple.mgmt."
+
+// NewMDM returns the MDM notification waking up the managed device to
+// contact the MDM server. The token and the PushMagic value are reported by
+// the device in the TokenUpdate check-in message; the token is the
+// hexadecimal string of the Token data.
+//
+// Send the notification with the client using the MDM push certificate: the
+// topic of the certificate is used.
+func NewMDM(token, pushMagic string) Notification {
+	return Notification{
+		Token:    token,
+		PushType: PushTypeMDM,
+		Payload:  map[string]string{"mdm": pushMagic},
+	}
+}
+
+// isMDM returns true if the topic is the MDM topic.
+func isMDM(topic string) bool {
+	return strings.HasPrefix(topic, MDMTopicPrefix)
+}
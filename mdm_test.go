@@ -0,0 +1,75 @@
+package apns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate with the bundle ID.
+func testCertificate(t testing.TB, bundleID string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "APSP:" + bundleID,
+			ExtraNames: []pkix.AttributeTypeAndValue{
+				{Type: typeBundle, Value: bundleID}},
+		},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: typeProduction, Value: []byte{5, 0}}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMDM(t *testing.T) {
+	cert := testCertificate(t, "com.apple.mgmt.External.0d0f2d48")
+	info := GetCertificateInfo(cert)
+	if !info.MDM || info.BundleID != "com.apple.mgmt.External.0d0f2d48" ||
+		!info.Production {
+		t.Fatalf("bad certificate info: %+v", info)
+	}
+	if GetCertificateInfo(testCertificate(t, "com.example.app")).MDM {
+		t.Error("app certificate is MDM")
+	}
+
+	f := newFakeAPNs(t)
+	client := f.client(t)
+	client.ci = info
+	n := NewMDM(testToken, "5D5E7A3C-6A8B-4E34-A1B2-B2F5E3A0E5F0")
+	if _, err := client.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	r, body := f.last()
+	if r.Header.Get("apns-push-type") != PushTypeMDM {
+		t.Error("bad push type:", r.Header.Get("apns-push-type"))
+	}
+	if string(body) != `{"mdm":"5D5E7A3C-6A8B-4E34-A1B2-B2F5E3A0E5F0"}` {
+		t.Error("bad payload:", string(body))
+	}
+	// the push type is set by the certificate
+	n.PushType = ""
+	if _, err := client.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := f.last(); r.Header.Get("apns-push-type") != PushTypeMDM {
+		t.Error("bad default push type:", r.Header.Get("apns-push-type"))
+	}
+}
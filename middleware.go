@@ -0,0 +1,173 @@
+package apns
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Logging returns a middleware that writes the result of every sent
+// notification to the logger. If logger is nil, the standard logger is used.
+func Logging(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next Sender) Sender {
+		return SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+			start := time.Now()
+			result, err := next.Send(ctx, n)
+			if err != nil {
+				logger.Printf("apns: push %s [%s] error: %v (%v)",
+					n.Token, result.ID, err, time.Since(start))
+			} else {
+				logger.Printf("apns: push %s [%s] sent (%v)",
+					n.Token, result.ID, time.Since(start))
+			}
+			return result, err
+		})
+	}
+}
+
+// Validate is a middleware that checks the notification before sending and
+// rejects the malformed ones locally, without a round trip to APNs. The
+// returned error is *Error with the same reason APNs would respond with.
+func Validate(next Sender) Sender {
+	return SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+		if err := n.Validate(); err != nil {
+			return Result{Token: n.Token}, err
+		}
+		return next.Send(ctx, n)
+	})
+}
+
+// reUUID checks the canonical form of the notification ID.
+var reUUID = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// payloadValidator is the typed payload checking its own fields.
+type payloadValidator interface {
+	Validate() error
+}
+
+// Validate checks the notification for errors that APNs would report. It
+// returns *Error with the corresponding reason or nil. The typed payloads,
+// like LiveActivity, are checked by their own rules and return their errors,
+// and the background notifications are checked to be silent.
+func (n *Notification) Validate() error {
+	if n.Token == "" {
+		return &Error{Status: http.StatusBadRequest, Reason: "MissingDeviceToken"}
+	}
+	if _, err := hex.DecodeString(n.Token); err != nil {
+		return &Error{Status: http.StatusBadRequest, Reason: "BadDeviceToken"}
+	}
+	if n.ID != "" && !reUUID.MatchString(n.ID) {
+		return &Error{Status: http.StatusBadRequest, Reason: "BadMessageId"}
+	}
+	if len(n.CollapseID) > 64 {
+		return &Error{Status: http.StatusBadRequest, Reason: "BadCollapseId"}
+	}
+	if payload, ok := n.Payload.(payloadValidator); ok {
+		if err := payload.Validate(); err != nil {
+			return err
+		}
+	}
+	payload, err := n.body()
+	if err != nil {
+		return err
+	}
+	if len(payload) == 0 {
+		return &Error{Status: http.StatusBadRequest, Reason: "PayloadEmpty"}
+	}
+	if len(payload) > n.maxPayloadSize() {
+		return &Error{Status: http.StatusRequestEntityTooLarge,
+			Reason: "PayloadTooLarge"}
+	}
+	if n.PushType == PushTypeBackground {
+		if !n.LowPriority {
+			return &Error{Status: http.StatusBadRequest, Reason: "BadPriority"}
+		}
+		return checkBackground(payload)
+	}
+	return nil
+}
+
+// MetricsCollector receives the outcome of every notification sent through
+// the Metrics middleware.
+type MetricsCollector interface {
+	Observe(n Notification, result Result, err error, elapsed time.Duration)
+}
+
+// Metrics returns a middleware that reports the result and the duration of
+// every sent notification to the collector.
+func Metrics(collector MetricsCollector) Middleware {
+	return func(next Sender) Sender {
+		return SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+			start := time.Now()
+			result, err := next.Send(ctx, n)
+			collector.Observe(n, result, err, time.Since(start))
+			return result, err
+		})
+	}
+}
+
+// Retry returns a middleware that repeats sending the notification when the
+// error is temporary (see Error.Temporary) or the request has timed out. The
+// delay between attempts starts with backoff and doubles after each attempt.
+// The number of attempts made is returned in Result.Attempts.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return func(next Sender) Sender {
+		return SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+			var (
+				result Result
+				err    error
+				delay  = backoff
+			)
+			for attempt := 1; ; attempt++ {
+				result, err = next.Send(ctx, n)
+				result.Attempts = attempt
+				if err == nil || attempt >= attempts || !isTemporary(err) {
+					return result, err
+				}
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return result, err
+				}
+				delay *= 2
+			}
+		})
+	}
+}
+
+// isTemporary returns true if sending of the notification that failed with
+// the err may be repeated.
+func isTemporary(err error) bool {
+	switch err := err.(type) {
+	case *Error:
+		return err.Temporary()
+	case interface{ Timeout() bool }:
+		return err.Timeout()
+	}
+	return false
+}
+
+// Concurrency returns a middleware that limits the number of notifications
+// being sent at the same time. The notifications above the limit wait for the
+// previous ones to complete or for the context to be done.
+func Concurrency(limit int) Middleware {
+	return func(next Sender) Sender {
+		var slots = make(chan struct{}, limit)
+		return SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return Result{Token: n.Token}, ctx.Err()
+			}
+			defer func() { <-slots }()
+			return next.Send(ctx, n)
+		})
+	}
+}
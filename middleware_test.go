@@ -0,0 +1,94 @@
+package apns
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testCollector struct {
+	mu    sync.Mutex
+	count int
+	fails int
+}
+
+func (c *testCollector) Observe(n Notification, result Result, err error,
+	elapsed time.Duration) {
+	c.mu.Lock()
+	c.count++
+	if err != nil {
+		c.fails++
+	}
+	c.mu.Unlock()
+}
+
+func TestMiddleware(t *testing.T) {
+	server := newFakeAPNs(t)
+	var attempts int
+	server.reply = func(r *http.Request) (int, string) {
+		if attempts++; attempts < 3 {
+			return http.StatusServiceUnavailable, "Shutdown"
+		}
+		return http.StatusOK, ""
+	}
+	var buf bytes.Buffer
+	collector := new(testCollector)
+	sender := Chain(server.client(t),
+		Logging(log.New(&buf, "", 0)),
+		Metrics(collector),
+		Validate,
+		Retry(3, time.Millisecond))
+
+	result, err := sender.Send(context.Background(), Notification{
+		Token:   testToken,
+		Payload: `{"aps":{"alert":"Test message"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Attempts != 3 || result.ID == "" {
+		t.Error("bad result:", result)
+	}
+	if !strings.Contains(buf.String(), testToken) {
+		t.Error("bad log:", buf.String())
+	}
+
+	_, err = sender.Send(context.Background(), Notification{
+		Token:   testToken,
+		Payload: strings.Repeat("x", MaxPayloadSize+1),
+	})
+	if err, ok := err.(*Error); !ok || err.Reason != "PayloadTooLarge" {
+		t.Error("bad validation error:", err)
+	}
+	if server.count() != 3 {
+		t.Error("bad request count:", server.count())
+	}
+	if collector.count != 2 || collector.fails != 1 {
+		t.Error("bad metrics:", collector.count, collector.fails)
+	}
+}
+
+func TestPoolSend(t *testing.T) {
+	server := newFakeAPNs(t)
+	pool := NewPool(Chain(server.client(t), Validate), 2, nil)
+	defer pool.Close()
+	result, err := pool.Send(context.Background(), Notification{
+		Token:   testToken,
+		Payload: `{"aps":{"alert":"Test message"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Token != testToken {
+		t.Error("bad result token:", result.Token)
+	}
+	_, err = pool.Send(context.Background(), Notification{Token: "XXXX"})
+	if err, ok := err.(*Error); !ok || err.Reason != "BadDeviceToken" {
+		t.Error("bad validation error:", err)
+	}
+}
@@ -1,14 +1,19 @@
 package apns
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// ExpireNow is the Expiration of the notification that APNs must not store:
+// it is sent with the apns-expiration 0 at any time, and the scheduled
+// notification with it is never dropped as expired.
+var ExpireNow = time.Unix(1, 0)
+
 // Notification describes the Remote Notification for sending to Apple Push.
 //
 // Each Apple Push Notification service (APNs) remote notification includes a
@@ -86,7 +91,9 @@ type Notification struct {
 	// to deliver it at least once, repeating the attempt as needed if it is
 	// unable to deliver the notification the first time. If the value is
 	// before now, APNs treats the notification as if it expires immediately
-	// and does not store the notification or attempt to redeliver it.
+	// and does not store the notification or attempt to redeliver it. Use
+	// ExpireNow for the notification that expires immediately whenever it is
+	// sent.
 	Expiration time.Time
 
 	// Specify the hexadecimal bytes (hex-string) of the device token for the
@@ -116,6 +123,12 @@ type Notification struct {
 	// user as a single notification. The value should not exceed 64 bytes.
 	CollapseID string
 
+	// The type of the notification, sent as apns-push-type header. The value
+	// must accurately reflect the contents of the notification payload: alert,
+	// background, voip, complication, fileprovider, mdm, liveactivity or
+	// pushtotalk. If you omit it, APNs treats the notification as alert.
+	PushType string
+
 	// The body content of your message is the JSON dictionary object containing
 	// the notification data. The body data must not be compressed and its
 	// maximum size is 4KB (4096 bytes). For a Voice over Internet Protocol
@@ -147,50 +160,98 @@ type Notification struct {
 // 	  header names to be added to the dynamic table; subsequent times you send
 // 	  these headers, encode them as literal header fields without indexing.
 // Encode all other headers as literal header fields with incremental indexing.
+// The net/http transport does not follow these rules: use Client.EnableHPACK
+// to send the requests with the Transport that does.
 //
 // The body content of your message is the JSON dictionary object containing the
 // notification data. The body data must not be compressed and its maximum size
 // is 4KB (4096 bytes). For a Voice over Internet Protocol (VoIP) notification,
 // the body data maximum size is 5KB (5120 bytes).
-func (n *Notification) request(host string) (req *http.Request, err error) {
-	var payload []byte
-	switch data := n.Payload.(type) {
-	case []byte:
-		payload = data
-	case string:
-		payload = []byte(data)
-	case json.RawMessage:
-		payload = []byte(data)
-	default:
-		payload, err = json.Marshal(n.Payload)
-		if err != nil {
-			return nil, err
-		}
+//
+// The body is encoded to the pooled buffer and the static header values are
+// shared by the requests: release the returned buffer once the response is
+// received and do not modify the header values.
+func (n *Notification) request(base *url.URL, path string) (
+	*http.Request, *bodyBuffer, error) {
+	buf := newBodyBuffer()
+	var err error
+	if buf.data, err = n.appendBody(buf.data); err != nil {
+		buf.release()
+		return nil, nil, err
 	}
-	req, err = http.NewRequest(http.MethodPost,
-		fmt.Sprintf("%s/3/device/%s", host, n.Token), bytes.NewReader(payload))
-	if err != nil {
-		return nil, err
+	u := *base
+	u.Path = path
+	req := &http.Request{
+		Method:        http.MethodPost,
+		URL:           &u,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header, 8),
+		Body:          buf.reader(),
+		GetBody:       func() (io.ReadCloser, error) { return buf.reader(), nil },
+		ContentLength: int64(len(buf.data)),
+		Host:          u.Host,
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header["Content-Type"] = headerJSON
 	if n.ID != "" {
-		req.Header.Set("apns-id", n.ID)
+		req.Header["Apns-Id"] = []string{n.ID}
 	}
 	if !n.Expiration.IsZero() {
-		var exp string = "0"
-		if !n.Expiration.Before(time.Now()) {
-			exp = strconv.FormatInt(n.Expiration.Unix(), 10)
+		if n.Expiration.Equal(ExpireNow) || n.Expiration.Before(time.Now()) {
+			req.Header["Apns-Expiration"] = headerExpireNow
+		} else {
+			req.Header["Apns-Expiration"] = []string{
+				strconv.FormatInt(n.Expiration.Unix(), 10)}
 		}
-		req.Header.Set("apns-expiration", exp)
 	}
 	if n.LowPriority {
-		req.Header.Set("apns-priority", "5")
+		req.Header["Apns-Priority"] = headerPriority5
 	}
 	if n.Topic != "" {
-		req.Header.Set("apns-topic", n.Topic)
+		req.Header["Apns-Topic"] = []string{n.Topic}
 	}
 	if n.CollapseID != "" && len(n.CollapseID) <= 64 {
-		req.Header.Set("apns-collapse-id", n.CollapseID)
+		req.Header["Apns-Collapse-Id"] = []string{n.CollapseID}
+	}
+	if n.PushType != "" {
+		if value, ok := headerPushTypes[n.PushType]; ok {
+			req.Header["Apns-Push-Type"] = value
+		} else {
+			req.Header["Apns-Push-Type"] = []string{n.PushType}
+		}
+	}
+	return req, buf, nil
+}
+
+// Notification push types.
+const (
+	PushTypeAlert        = "alert"
+	PushTypeBackground   = "background"
+	PushTypeVoIP         = "voip"
+	PushTypeComplication = "complication"
+	PushTypeFileProvider = "fileprovider"
+	PushTypeMDM          = "mdm"
+	PushTypeLiveActivity = "liveactivity"
+	PushTypePushToTalk   = "pushtotalk"
+)
+
+// Maximum payload size for a notification.
+const (
+	MaxPayloadSize     = 4096 // regular push notification
+	MaxVoIPPayloadSize = 5120 // Voice over Internet Protocol (VoIP) notification
+)
+
+// body returns the JSON dictionary object containing the notification data.
+func (n *Notification) body() ([]byte, error) {
+	return n.appendBody(nil)
+}
+
+// maxPayloadSize returns the maximum payload size allowed for the
+// notification.
+func (n *Notification) maxPayloadSize() int {
+	if n.PushType == PushTypeVoIP || strings.HasSuffix(n.Topic, ".voip") {
+		return MaxVoIPPayloadSize
 	}
-	return req, nil
+	return MaxPayloadSize
 }
@@ -0,0 +1,54 @@
+package apns
+
+// Payload is the typed payload of the notification: the Apple-reserved aps
+// dictionary and the custom values. Use it as the Notification Payload.
+type Payload struct {
+	APS    APS                    // the aps dictionary
+	Custom map[string]interface{} // custom values outside of the aps
+}
+
+// APS is the Apple-reserved aps dictionary of the payload.
+type APS struct {
+	Alert             *Alert // alert to display to the user
+	Badge             *int   // number to badge the app icon with; 0 removes it
+	Sound             string // name of the sound file to play
+	ThreadID          string // identifier to group the notifications
+	Category          string // notification type with the custom actions
+	ContentAvailable  bool   // wake up the app in the background
+	MutableContent    bool   // let the notification service extension modify it
+	InterruptionLevel string // passive, active, time-sensitive or critical
+}
+
+// Alert is the alert of the notification. The texts may be localized by the
+// app with the localization keys and arguments of its bundle strings.
+type Alert struct {
+	Title    string `json:"title,omitempty"`
+	Subtitle string `json:"subtitle,omitempty"`
+	Body     string `json:"body,omitempty"`
+
+	TitleLocKey     string   `json:"title-loc-key,omitempty"`
+	TitleLocArgs    []string `json:"title-loc-args,omitempty"`
+	SubtitleLocKey  string   `json:"subtitle-loc-key,omitempty"`
+	SubtitleLocArgs []string `json:"subtitle-loc-args,omitempty"`
+	LocKey          string   `json:"loc-key,omitempty"`
+	LocArgs         []string `json:"loc-args,omitempty"`
+}
+
+// MarshalJSON returns the payload in JSON format. The aps key of the custom
+// values is ignored. The payload is encoded without reflection, except for the
+// custom values of the uncommon types.
+func (p Payload) MarshalJSON() ([]byte, error) {
+	return p.appendJSON(nil)
+}
+
+// typedPayload returns the typed Payload of the notification, set either by
+// pointer or by value. The value is returned as a pointer to its copy.
+func (n *Notification) typedPayload() (*Payload, bool) {
+	switch payload := n.Payload.(type) {
+	case *Payload:
+		return payload, payload != nil
+	case Payload:
+		return &payload, true
+	}
+	return nil, false
+}
@@ -1,5 +1,12 @@
 package apns
 
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
 // ClientsPool manages a pool of Clients.
 //
 // The APNs server allows multiple concurrent streams for each connection. The
@@ -9,7 +16,19 @@ package apns
 // certificate, only one stream is allowed on the connection until you send a
 // push message with valid token.
 type ClientsPool struct {
-	notifications chan Notification
+	sender        Sender
+	client        *Client         // the base client of the sender, if any
+	breaker       *CircuitBreaker // pauses workers while APNs is unavailable
+	notifications chan poolItem   // dequeued by workers
+	lanes         []chan poolItem // priority lanes, from the highest
+	responses     chan<- Response
+	scheduler     *scheduler     // notifications scheduled for later
+	queue         *DiskQueue     // write-ahead log of the queued notifications
+	deadLetters   DeadLetterSink // permanently rejected notifications
+	closing       sync.RWMutex   // held by background senders to the lanes
+	closed        bool           // the lanes are closed
+	quit          chan struct{}  // closed when the pool is closing
+	quitOnce      sync.Once
 }
 
 // Response from sending a notification.
@@ -19,6 +38,21 @@ type Response struct {
 	Error error  // Error describes the error response from the server
 }
 
+// poolItem is a queued notification.
+type poolItem struct {
+	ctx          context.Context
+	notification Notification
+	done         chan<- poolResult // nil for asynchronous push
+	seq          uint64            // number in the disk queue; 0 — not stored
+	queued       time.Time         // the time the notification was queued
+}
+
+// poolResult is the result of sending a queued notification.
+type poolResult struct {
+	result Result
+	err    error
+}
+
 // Pool wraps a client with a queue for sending notifications asynchronously.
 //
 // You can establish multiple connections to APNs servers to improve
@@ -27,33 +61,165 @@ type Response struct {
 // performance, compared to using a single connection, by letting you send
 // remote notifications faster and by letting APNs deliver them faster.
 func (c *Client) Pool(workers uint, responses chan<- Response) *ClientsPool {
-	notifications := make(chan Notification)
-	// startup workers to send notifications
-	for i := uint(0); i < workers; i++ {
-		go func() {
-			for n := range notifications {
-				id, err := c.Push(n)
-				if responses != nil {
-					responses <- Response{n.Token, id, err}
-				}
+	return NewPool(c, workers, responses)
+}
+
+// NewPool returns a pool of workers sending the queued notifications with the
+// sender. Use it to send notifications through the client wrapped with
+// middleware.
+//
+// If the sender is a Client (or a Client wrapped with Chain) with the circuit
+// breaker, the workers stop dequeuing notifications while the breaker is open
+// and hold the already dequeued ones until it lets them through.
+// The workers of the Client hold the dequeued notifications while its Connect
+// is in progress.
+func NewPool(sender Sender, workers uint, responses chan<- Response) *ClientsPool {
+	return NewPriorityPool(sender, workers, responses)
+}
+
+// worker sends the queued notifications until the pool is closed.
+func (p *ClientsPool) worker() {
+	for {
+		if p.breaker != nil {
+			p.breaker.wait(context.Background())
+		}
+		item, ok := <-p.notifications
+		if !ok {
+			return
+		}
+		result, err := p.send(item)
+		if item.seq != 0 {
+			if isTransportError(err) {
+				// keep the notification that did not reach APNs in the queue
+				// and send it again
+				p.retryLater(item)
+				continue
+			}
+			if err := p.queue.done(item.seq); err != nil {
+				p.queue.logf("apns: notification %s is not marked done: %v",
+					item.notification.ID, err)
 			}
-		}()
+		}
+		if item.done != nil {
+			item.done <- poolResult{result, err}
+			continue
+		}
+		if result.ID == "" {
+			result.ID = item.notification.ID
+		}
+		err = p.deadLetter(item, result, err)
+		if p.responses != nil {
+			p.responses <- Response{item.notification.Token, result.ID, err}
+		}
 	}
-	return &ClientsPool{
-		notifications: notifications,
+}
+
+// send sends the dequeued notification after Connect in progress. The
+// notification dequeued before the circuit breaker opened is held until the
+// breaker lets it through, so it does not fail with ErrCircuitOpen.
+func (p *ClientsPool) send(item poolItem) (Result, error) {
+	if p.client != nil {
+		p.client.waitConnect(item.ctx)
+	}
+	for {
+		result, err := p.sender.Send(item.ctx, item.notification)
+		if p.breaker == nil || !errors.Is(err, ErrCircuitOpen) {
+			return result, err
+		}
+		if err := p.breaker.wait(item.ctx); err != nil {
+			return Result{Token: item.notification.Token}, err
+		}
 	}
 }
 
 // Push queues a notification to the APN service.
+//
+// If the pool persists notifications to the disk queue, the notification is
+// written to the queue before Push returns. The notification that cannot be
+// written is not sent, and the response with the error is sent to the
+// responses channel. The notifications pushed after Close are not sent; the
+// disk queue keeps them for the next run.
 func (p *ClientsPool) Push(n Notification, tokens ...string) {
+	p.PushLane(p.laneOf(n), n, tokens...)
+}
+
+// PushLane queues a notification to the APN service using the specified
+// priority lane: 0 is the highest priority lane. Pushing blocks while the lane
+// is full.
+func (p *ClientsPool) PushLane(lane int, n Notification, tokens ...string) {
+	if lane < 0 {
+		lane = 0
+	} else if lane >= len(p.lanes) {
+		lane = len(p.lanes) - 1
+	}
 	for _, token := range tokens {
 		n.Token = token
-		p.notifications <- n
+		item := poolItem{ctx: context.Background(), notification: n,
+			queued: time.Now()}
+		if p.queue != nil {
+			var err error
+			if item.seq, err = p.queue.append(&item.notification); err != nil {
+				if p.responses != nil {
+					p.responses <- Response{token, item.notification.ID, err}
+				}
+				continue
+			}
+		}
+		if !p.enqueue(lane, item) {
+			return
+		}
+	}
+}
+
+// Send queues the notification and waits for the response from APNs. The
+// response is returned to the caller instead of the responses channel. Send
+// implements the Sender interface, so the pool can be wrapped with middleware.
+func (p *ClientsPool) Send(ctx context.Context, n Notification) (Result, error) {
+	done := make(chan poolResult, 1)
+	select {
+	case p.lanes[p.laneOf(n)] <- poolItem{ctx: ctx, notification: n,
+		done: done, queued: time.Now()}:
+	case <-ctx.Done():
+		return Result{Token: n.Token}, ctx.Err()
+	}
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-ctx.Done():
+		return Result{Token: n.Token}, ctx.Err()
 	}
 }
 
 // Close the channels for notifications and Responses and shutdown workers.
-// You should only call this after all responses have been received.
+// You should only call this after all responses have been received. The
+// notifications scheduled for later are dropped.
 func (p *ClientsPool) Close() {
-	close(p.notifications)
+	p.scheduler.close()
+	p.quitOnce.Do(func() { close(p.quit) }) // wake up the blocked senders
+	p.closing.Lock()
+	defer p.closing.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for _, lane := range p.lanes {
+		close(lane)
+	}
+}
+
+// enqueue sends the item to the lane unless the pool is closed and reports
+// whether it was sent. Close wakes up the blocked senders, so it never waits
+// for a free worker.
+func (p *ClientsPool) enqueue(lane int, item poolItem) bool {
+	p.closing.RLock()
+	defer p.closing.RUnlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.lanes[lane] <- item:
+		return true
+	case <-p.quit:
+		return false
+	}
 }
@@ -0,0 +1,251 @@
+package apns
+
+import (
+	"archive/zip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// ErrPushPackageKey is returned when the push package is signed by the
+// certificate without a supported private key.
+var ErrPushPackageKey = errors.New("unsupported push package signing key")
+
+// Website describes the website of the push package: the website.json file.
+type Website struct {
+	WebsiteName         string   `json:"websiteName"`
+	WebsitePushID       string   `json:"websitePushID"`
+	AllowedDomains      []string `json:"allowedDomains"`
+	URLFormatString     string   `json:"urlFormatString"`
+	AuthenticationToken string   `json:"authenticationToken"`
+	WebServiceURL       string   `json:"webServiceURL"`
+}
+
+// PushPackage is the Safari push package of the website: the website
+// description and the icon set. The package is downloaded by Safari when the
+// user allows the website to send notifications.
+type PushPackage struct {
+	Website Website
+	// Icons are the PNG images by file name: icon_16x16.png,
+	// icon_16x16@2x.png, icon_32x32.png, icon_32x32@2x.png, icon_128x128.png
+	// and icon_128x128@2x.png.
+	Icons map[string][]byte
+}
+
+// files returns the files of the push package by path without the manifest
+// and the signature.
+func (p *PushPackage) files() (map[string][]byte, error) {
+	website, err := json.Marshal(p.Website)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{"website.json": website}
+	for name, data := range p.Icons {
+		files["icon.iconset/"+name] = data
+	}
+	return files, nil
+}
+
+// manifest returns the manifest.json with the SHA-512 hashes of the files.
+func manifest(files map[string][]byte) ([]byte, error) {
+	type hash struct {
+		HashType  string `json:"hashType"`
+		HashValue string `json:"hashValue"`
+	}
+	var hashes = make(map[string]hash, len(files))
+	for name, data := range files {
+		sum := sha512.Sum512(data)
+		hashes[name] = hash{"sha512", hex.EncodeToString(sum[:])}
+	}
+	return json.Marshal(hashes)
+}
+
+// Write writes the zip archive of the push package signed with the website
+// push certificate. See SignManifest for the certificates included in the
+// signature.
+func (p *PushPackage) Write(w io.Writer, certificate *tls.Certificate) error {
+	files, err := p.files()
+	if err != nil {
+		return err
+	}
+	if files["manifest.json"], err = manifest(files); err != nil {
+		return err
+	}
+	if files["signature"], err = SignManifest(files["manifest.json"],
+		certificate); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	archive := zip.NewWriter(w)
+	for _, name := range names {
+		file, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// PKCS#7 object identifiers.
+var (
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"` // EXPLICIT [0]
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     []asn1.RawValue   `asn1:"optional,set,tag:0"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// SignManifest returns the detached PKCS#7 signature of the push package
+// manifest in DER format, the signature file of the push package. The
+// manifest is signed with SHA-256 by the private key of the certificate; the
+// certificates of the chain are included in the signature.
+//
+// LoadCertificate keeps only the leaf certificate, so append the DER bytes of
+// the intermediate certificates, like the Apple WWDR certificate, to the
+// Certificate chain to include them.
+func SignManifest(manifest []byte, certificate *tls.Certificate) ([]byte, error) {
+	signer, ok := certificate.PrivateKey.(crypto.Signer)
+	if !ok || len(certificate.Certificate) == 0 {
+		return nil, ErrPushPackageKey
+	}
+	var signatureAlgorithm pkix.AlgorithmIdentifier
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption,
+			Parameters: asn1.NullRawValue}
+	case *ecdsa.PublicKey:
+		signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	default:
+		return nil, ErrPushPackageKey
+	}
+	leaf := certificate.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(certificate.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	// the signature covers the DER encoding of the authenticated attributes
+	digest := sha256.Sum256(manifest)
+	attributes, err := pkcs7Attributes(digest[:], time.Now())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(attributes)
+	signature, err := signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256,
+		Parameters: asn1.NullRawValue}
+	signedData := pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+		ContentInfo:      pkcs7ContentInfo{ContentType: oidData}, // detached
+		SignerInfos: []pkcs7SignerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: pkcs7IssuerAndSerial{
+				Issuer: asn1.RawValue{FullBytes: leaf.RawIssuer},
+				Serial: leaf.SerialNumber,
+			},
+			DigestAlgorithm: sha256Algorithm,
+			// the attributes are IMPLICIT [0] in the signer info
+			AuthenticatedAttributes: asn1.RawValue{FullBytes: append(
+				[]byte{0xa0}, attributes[1:]...)},
+			DigestEncryptionAlgorithm: signatureAlgorithm,
+			EncryptedDigest:           signature,
+		}},
+	}
+	for _, cert := range certificate.Certificate {
+		signedData.Certificates = append(signedData.Certificates,
+			asn1.RawValue{FullBytes: cert})
+	}
+	content, err := asn1.Marshal(signedData)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0,
+			IsCompound: true, Bytes: content},
+	})
+}
+
+// pkcs7Attributes returns the DER encoded SET of the authenticated attributes
+// with the message digest.
+func pkcs7Attributes(digest []byte, signingTime time.Time) ([]byte, error) {
+	values := []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidContentType, oidData},
+		{oidSigningTime, signingTime.UTC()},
+		{oidMessageDigest, digest},
+	}
+	var attributes = make([]pkcs7Attribute, len(values))
+	for i, attr := range values {
+		data, err := asn1.Marshal(attr.value)
+		if err != nil {
+			return nil, err
+		}
+		attributes[i] = pkcs7Attribute{Type: attr.oid,
+			Values: []asn1.RawValue{{FullBytes: data}}}
+	}
+	return asn1.MarshalWithParams(attributes, "set")
+}
@@ -0,0 +1,485 @@
+package apns
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy defines when the DiskQueue flushes the written records to the
+// disk.
+type SyncPolicy uint8
+
+// Disk synchronization policies.
+const (
+	SyncAlways   SyncPolicy = iota // fsync after every record
+	SyncInterval                   // fsync every DiskQueue.SyncEvery
+	SyncNever                      // leave it to the operating system
+)
+
+// DiskQueue is a write-ahead log of the queued notifications stored in a
+// local directory.
+//
+// The pool appends every pushed notification to the log before the Push
+// returns and marks it done after the final result: the APNs response or the
+// local error of the notification. The notification that failed to reach
+// APNs because of the connection is sent again while the pool runs, without the
+// response. After a crash or a restart, the
+// notifications that are not marked done are sent again with their original
+// apns-id, so APNs and the app can recognize the duplicates.
+//
+// The log is split into segment files of SegmentSize bytes. Segments whose
+// notifications are all done are deleted, and the remaining notifications are
+// rewritten to a new segment when the queue is opened.
+type DiskQueue struct {
+	SegmentSize int64         // maximum size of the segment file
+	SyncEvery   time.Duration // fsync period for SyncInterval policy
+	// ErrorLog specifies the logger for the errors of marking notifications
+	// done. If nil, the log package's standard logger is used.
+	ErrorLog *log.Logger
+
+	dir      string
+	policy   SyncPolicy
+	mu       sync.Mutex
+	file     *os.File       // current segment
+	segment  int            // current segment number
+	size     int64          // current segment size
+	seq      uint64         // last record number
+	pending  map[uint64]int // segment numbers of the pending notifications
+	live     map[int]int    // the number of pending notifications by segment
+	replay   []queued       // pending notifications loaded from the disk
+	dirty    bool           // there are not synchronized records
+	skipped  int            // corrupt records skipped when loading
+	stopSync chan struct{}
+}
+
+// Persist makes the pool store the pushed notifications in the queue before
+// sending them, and queues the notifications left in the queue since the last
+// run. Call it once before pushing notifications to the pool.
+func (p *ClientsPool) Persist(q *DiskQueue) {
+	p.queue = q
+	replay := q.pendingNotifications()
+	if len(replay) == 0 {
+		return
+	}
+	go func() {
+		for _, item := range replay {
+			if !p.enqueue(p.laneOf(item.notification), poolItem{
+				ctx:          context.Background(),
+				notification: item.notification,
+				seq:          item.seq,
+				queued:       time.Now(),
+			}) {
+				return // the rest is replayed after the next start
+			}
+		}
+	}()
+}
+
+// queueRetryDelay is the delay before the persisted notification that failed
+// to reach APNs is sent again.
+const queueRetryDelay = time.Second
+
+// retryLater queues the persisted notification again after queueRetryDelay.
+// If the pool is closed before that, the notification is left in the disk
+// queue for the next run.
+func (p *ClientsPool) retryLater(item poolItem) {
+	time.AfterFunc(queueRetryDelay, func() {
+		p.enqueue(p.laneOf(item.notification), item)
+	})
+}
+
+// isTransportError returns true if the notification failed to reach APNs
+// because of the connection or the proxy.
+func isTransportError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// queued is a notification stored in the queue.
+type queued struct {
+	seq          uint64
+	notification Notification
+}
+
+// jsonNotification is a notification in JSON format with the encoded
+// payload.
+type jsonNotification struct {
+	Token       string          `json:"token"`
+	ID          string          `json:"id,omitempty"`
+	Expiration  int64           `json:"expiration,omitempty"`
+	LowPriority bool            `json:"lowPriority,omitempty"`
+	Topic       string          `json:"topic,omitempty"`
+	CollapseID  string          `json:"collapseId,omitempty"`
+	PushType    string          `json:"pushType,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+// newJSONNotification returns the notification in JSON format.
+func newJSONNotification(n Notification) (*jsonNotification, error) {
+	payload, err := n.body()
+	if err != nil {
+		return nil, err
+	}
+	jn := &jsonNotification{
+		Token:       n.Token,
+		ID:          n.ID,
+		LowPriority: n.LowPriority,
+		Topic:       n.Topic,
+		CollapseID:  n.CollapseID,
+		PushType:    n.PushType,
+		Payload:     payload,
+	}
+	if !n.Expiration.IsZero() {
+		jn.Expiration = n.Expiration.Unix()
+	}
+	return jn, nil
+}
+
+// notification returns the notification restored from JSON format.
+func (jn *jsonNotification) notification() Notification {
+	n := Notification{
+		Token:       jn.Token,
+		ID:          jn.ID,
+		LowPriority: jn.LowPriority,
+		Topic:       jn.Topic,
+		CollapseID:  jn.CollapseID,
+		PushType:    jn.PushType,
+		Payload:     jn.Payload,
+	}
+	if jn.Expiration != 0 {
+		n.Expiration = time.Unix(jn.Expiration, 0)
+	}
+	return n
+}
+
+// queueRecord is a record of the queue log.
+type queueRecord struct {
+	Seq          uint64            `json:"seq"`
+	Done         bool              `json:"done,omitempty"`
+	Notification *jsonNotification `json:"notification,omitempty"`
+}
+
+// OpenDiskQueue opens or creates the queue in the directory and loads the
+// notifications that were not marked done.
+func OpenDiskQueue(dir string, policy SyncPolicy) (*DiskQueue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	q := &DiskQueue{
+		SegmentSize: 64 << 20,
+		SyncEvery:   time.Second,
+		dir:         dir,
+		policy:      policy,
+		pending:     make(map[uint64]int),
+		live:        make(map[int]int),
+	}
+	segments, err := q.segments()
+	if err != nil {
+		return nil, err
+	}
+	var records = make(map[uint64]*jsonNotification)
+	for _, segment := range segments {
+		if err := q.load(segment, records); err != nil {
+			return nil, err
+		}
+		q.segment = segment
+	}
+	q.segment++
+	if err := q.rotate(); err != nil {
+		return nil, err
+	}
+	// compaction: rewrite the pending notifications to the new segment
+	seqs := make([]uint64, 0, len(records))
+	for seq := range records {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		if err := q.write(&queueRecord{Seq: seq,
+			Notification: records[seq]}); err != nil {
+			return nil, err
+		}
+		q.pending[seq] = q.segment
+		q.live[q.segment]++
+		q.replay = append(q.replay, queued{seq, records[seq].notification()})
+	}
+	if err := q.file.Sync(); err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		if err := os.Remove(q.filename(segment)); err != nil {
+			return nil, err
+		}
+	}
+	if policy == SyncInterval {
+		q.stopSync = make(chan struct{})
+		go q.syncLoop()
+	}
+	return q, nil
+}
+
+// Skipped returns the number of corrupt records skipped when the queue was
+// opened. The notifications of these records are lost.
+func (q *DiskQueue) Skipped() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.skipped
+}
+
+// logf prints the error to the ErrorLog or to the standard logger.
+func (q *DiskQueue) logf(format string, args ...interface{}) {
+	if q.ErrorLog != nil {
+		q.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Len returns the number of notifications not marked done.
+func (q *DiskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Close flushes and closes the queue.
+func (q *DiskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopSync != nil {
+		close(q.stopSync)
+		q.stopSync = nil
+	}
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Sync()
+	if errClose := q.file.Close(); err == nil {
+		err = errClose
+	}
+	q.file = nil
+	return err
+}
+
+// append writes the notification to the queue and returns its number. The
+// notification without ID gets a new one, so it is sent with the same apns-id
+// after the replay.
+func (q *DiskQueue) append(n *Notification) (uint64, error) {
+	if n.ID == "" {
+		n.ID = newUUID()
+	}
+	jn, err := newJSONNotification(*n)
+	if err != nil {
+		return 0, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	if err := q.write(&queueRecord{Seq: q.seq, Notification: jn}); err != nil {
+		return 0, err
+	}
+	q.pending[q.seq] = q.segment
+	q.live[q.segment]++
+	return q.seq, nil
+}
+
+// done marks the notification as done and deletes the segments with only
+// done notifications.
+func (q *DiskQueue) done(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	segment, ok := q.pending[seq]
+	if !ok {
+		return nil
+	}
+	if err := q.write(&queueRecord{Seq: seq, Done: true}); err != nil {
+		return err
+	}
+	delete(q.pending, seq)
+	q.live[segment]--
+	// delete the oldest segments: the newer segments may contain done
+	// records of the notifications from the older ones
+	for {
+		oldest := q.segment
+		for segment := range q.live {
+			if segment < oldest {
+				oldest = segment
+			}
+		}
+		if oldest == q.segment || q.live[oldest] > 0 {
+			return nil
+		}
+		delete(q.live, oldest)
+		if err := os.Remove(q.filename(oldest)); err != nil {
+			return err
+		}
+	}
+}
+
+// pendingNotifications returns the notifications loaded from the disk when
+// the queue was opened and clears the list.
+func (q *DiskQueue) pendingNotifications() []queued {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	replay := q.replay
+	q.replay = nil
+	return replay
+}
+
+// write appends the record to the current segment. It is called with the lock
+// held.
+func (q *DiskQueue) write(record *queueRecord) error {
+	if q.file == nil {
+		return os.ErrClosed
+	}
+	if q.size >= q.SegmentSize {
+		q.segment++
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	n, err := q.file.Write(data)
+	q.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if q.policy == SyncAlways {
+		return q.file.Sync()
+	}
+	q.dirty = true
+	return nil
+}
+
+// rotate closes the current segment file and creates a new one.
+func (q *DiskQueue) rotate() error {
+	if q.file != nil {
+		if err := q.file.Sync(); err != nil {
+			return err
+		}
+		if err := q.file.Close(); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(q.filename(q.segment),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	q.file, q.size = file, 0
+	if _, ok := q.live[q.segment]; !ok {
+		q.live[q.segment] = 0
+	}
+	return nil
+}
+
+// syncLoop periodically flushes the written records to the disk.
+func (q *DiskQueue) syncLoop() {
+	ticker := time.NewTicker(q.SyncEvery)
+	defer ticker.Stop()
+	for {
+		q.mu.Lock()
+		stop := q.stopSync
+		q.mu.Unlock()
+		if stop == nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+			q.mu.Lock()
+			if q.dirty && q.file != nil {
+				q.file.Sync()
+				q.dirty = false
+			}
+			q.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// load reads the segment file and updates the pending notifications. The
+// corrupt records, like an incomplete last record left by a crash, are
+// skipped and logged to the standard logger.
+func (q *DiskQueue) load(segment int, records map[uint64]*jsonNotification) error {
+	file, err := os.Open(q.filename(segment))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var record queueRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			q.skipped++
+			q.logf("apns: skipped corrupt record %s:%d: %v",
+				q.filename(segment), line, err)
+			continue
+		}
+		if record.Seq > q.seq {
+			q.seq = record.Seq
+		}
+		if record.Done {
+			delete(records, record.Seq)
+		} else if record.Notification != nil {
+			records[record.Seq] = record.Notification
+		}
+	}
+	return scanner.Err()
+}
+
+// segments returns the sorted numbers of the segment files.
+func (q *DiskQueue) segments() ([]int, error) {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []int
+	for _, file := range files {
+		var segment int
+		name := file.Name()
+		if !strings.HasSuffix(name, ".wal") {
+			continue
+		}
+		if _, err := fmt.Sscanf(name, "%08d.wal", &segment); err == nil {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+// filename returns the name of the segment file.
+func (q *DiskQueue) filename(segment int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%08d.wal", segment))
+}
+
+// newUUID returns a new random UUID in the canonical form.
+func newUUID() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		panic(err)
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40 // version 4
+	uuid[8] = uuid[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x",
+		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
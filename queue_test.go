@@ -0,0 +1,120 @@
+package apns
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiskQueue(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDiskQueue(dir, SyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.SegmentSize = 256 // rotate segments often
+	// the connection fails for the second token and the third one fails
+	// locally
+	failed := make(chan string, 10)
+	failing := SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+		switch n.Token {
+		case "02":
+			failed <- n.ID
+			return Result{Token: n.Token}, &url.Error{
+				Op: "Post", URL: "https://" + DevelopmentHost,
+				Err: errors.New("connection reset")}
+		case "03":
+			return Result{Token: n.Token}, ErrCoalesced
+		}
+		return Result{Token: n.Token, ID: n.ID}, nil
+	})
+	responses := make(chan Response, 3)
+	pool := NewPool(failing, 1, responses)
+	pool.Persist(queue)
+	pool.Push(Notification{Payload: `{"aps":{"alert":"Hello"}}`}, "01", "02", "03")
+	for i := 0; i < 2; i++ {
+		if r := <-responses; r.Token == "02" {
+			t.Error("response for the notification to retry:", r)
+		}
+	}
+	id := <-failed
+	pool.Close()
+	if queue.Len() != 1 {
+		t.Error("bad pending count:", queue.Len())
+	}
+	if err := queue.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart
+	queue, err = OpenDiskQueue(dir, SyncInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	if queue.Len() != 1 {
+		t.Fatal("bad restored count:", queue.Len())
+	}
+	if segments, _ := queue.segments(); len(segments) != 1 {
+		t.Error("segments are not compacted:", segments)
+	}
+	pool = NewPool(new(countSender), 1, responses)
+	defer pool.Close()
+	pool.Persist(queue)
+	select {
+	case r := <-responses:
+		if r.Token != "02" || r.ID != id || r.ID == "" {
+			t.Error("bad replayed notification:", r, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notification is not replayed")
+	}
+	if queue.Len() != 0 {
+		t.Error("replayed notification is not done:", queue.Len())
+	}
+}
+
+func TestDiskQueueCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	records := []string{
+		`{"seq":1,"notification":{"token":"01","id":"1"}}`,
+		`{"seq":2,"notif`, // corrupt in the middle of the segment
+		`{"seq":3,"notification":{"token":"03","id":"3"}}`,
+		`{"seq":1,"done":true}`,
+		`{"seq":4,"notification":{"token":"04"`, // incomplete by a crash
+	}
+	err := ioutil.WriteFile(filepath.Join(dir, "00000001.wal"),
+		[]byte(strings.Join(records, "\n")), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	queue, err := OpenDiskQueue(dir, SyncNever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	if queue.Skipped() != 2 {
+		t.Error("bad skipped count:", queue.Skipped())
+	}
+	if queue.Len() != 1 {
+		t.Fatal("records after the corrupt one are not loaded:", queue.Len())
+	}
+
+	// the pool closed before the replay keeps the notification in the queue
+	pool := NewPool(new(countSender), 0, nil)
+	pool.Persist(queue)
+	time.Sleep(10 * time.Millisecond) // the replay waits for a worker
+	pool.Close()
+	if queue.Len() != 1 {
+		t.Error("bad pending count:", queue.Len())
+	}
+}
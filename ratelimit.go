@@ -0,0 +1,219 @@
+package apns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCoalesced is returned for a notification that was held back by the rate
+// limiter and replaced by a newer notification with the same collapse
+// identifier for the same device.
+var ErrCoalesced = errors.New("notification coalesced with a newer one")
+
+// LimitPolicy defines what the RateLimiter does with a notification that
+// exceeds the rate limit of the device token.
+type LimitPolicy uint8
+
+// Rate limiting policies.
+const (
+	// LimitDelay waits until the device token may receive a notification.
+	LimitDelay LimitPolicy = iota
+	// LimitDrop rejects the notification with a TooManyRequests error.
+	LimitDrop
+	// LimitCoalesce waits like LimitDelay, but keeps only the latest of the
+	// waiting notifications with the same collapse identifier. Replaced
+	// notifications return ErrCoalesced.
+	LimitCoalesce
+)
+
+// RateLimiter limits the rate of notifications sent to each device token and
+// topic to avoid the TooManyRequests response from APNs.
+//
+// It uses a token bucket per device: the bucket holds up to Burst
+// notifications and is refilled with one notification per Interval. Buckets
+// that were not used for IdleTimeout and are completely refilled are removed,
+// so the memory used by the limiter stays bounded.
+type RateLimiter struct {
+	Interval    time.Duration // the time to refill one notification
+	Burst       int           // the maximum number of notifications in a row
+	Policy      LimitPolicy   // the policy for exceeding notifications
+	IdleTimeout time.Duration // the time after which unused buckets are removed
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time // last garbage collection time
+}
+
+// bucket describes the rate limiting state of the device token.
+type bucket struct {
+	tokens  float64              // available notifications (may be negative)
+	updated time.Time            // last refill time
+	pending map[string]*coalesce // waiting notifications by collapse ID
+}
+
+// coalesce describes a notification waiting to be sent with LimitCoalesce
+// policy.
+type coalesce struct {
+	at       time.Time     // the time the notification may be sent
+	replaced chan struct{} // closed when replaced by a newer notification
+}
+
+// NewRateLimiter returns a new RateLimiter allowing burst notifications for
+// each device token and then one notification per interval.
+func NewRateLimiter(interval time.Duration, burst int, policy LimitPolicy) *RateLimiter {
+	return &RateLimiter{
+		Interval:    interval,
+		Burst:       burst,
+		Policy:      policy,
+		IdleTimeout: 10 * time.Minute,
+	}
+}
+
+// Middleware limits the rate of notifications sent with the next sender. It
+// has the Middleware signature, so it can be used with Chain.
+func (l *RateLimiter) Middleware(next Sender) Sender {
+	return SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+		if err := l.wait(ctx, n); err != nil {
+			return Result{Token: n.Token}, err
+		}
+		return next.Send(ctx, n)
+	})
+}
+
+// Len returns the number of device tokens tracked by the limiter.
+func (l *RateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// wait blocks until the notification may be sent according to the policy.
+func (l *RateLimiter) wait(ctx context.Context, n Notification) error {
+	var (
+		key     = n.Token + "\x00" + n.Topic
+		now     = time.Now()
+		at      time.Time
+		pending *coalesce
+	)
+	l.mu.Lock()
+	l.sweep(now)
+	b := l.refill(key, now)
+	switch {
+	case b.tokens >= 1:
+		b.tokens--
+		l.mu.Unlock()
+		return nil
+	case l.Policy == LimitDrop:
+		l.mu.Unlock()
+		return &Error{Status: http.StatusTooManyRequests, Reason: "TooManyRequests"}
+	case l.Policy == LimitCoalesce && n.CollapseID != "":
+		pending = &coalesce{replaced: make(chan struct{})}
+		if prev, ok := b.pending[n.CollapseID]; ok {
+			// take the place of the previous notification in the queue
+			close(prev.replaced)
+			pending.at = prev.at
+		} else {
+			pending.at = l.reserve(b, now)
+		}
+		if b.pending == nil {
+			b.pending = make(map[string]*coalesce)
+		}
+		b.pending[n.CollapseID] = pending
+		at = pending.at
+	default:
+		at = l.reserve(b, now)
+	}
+	l.mu.Unlock()
+
+	var replaced chan struct{}
+	if pending != nil {
+		replaced = pending.replaced
+	}
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		if !l.release(b, n.CollapseID, pending, false) {
+			return ErrCoalesced
+		}
+		return nil
+	case <-replaced:
+		return ErrCoalesced
+	case <-ctx.Done():
+		l.release(b, n.CollapseID, pending, true)
+		return ctx.Err()
+	}
+}
+
+// release removes the waiting notification from the bucket and returns false
+// if it was replaced by a newer one. The canceled notification returns its
+// reservation to the bucket unless the newer notification took it.
+func (l *RateLimiter) release(b *bucket, collapseID string, pending *coalesce,
+	canceled bool) bool {
+	if pending == nil && !canceled {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if pending != nil {
+		if b.pending[collapseID] != pending {
+			return false
+		}
+		delete(b.pending, collapseID)
+	}
+	if canceled {
+		b.tokens++
+	}
+	return true
+}
+
+// refill returns the bucket for the key refilled up to the time now.
+func (l *RateLimiter) refill(key string, now time.Time) *bucket {
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), updated: now}
+		l.buckets[key] = b
+		return b
+	}
+	if l.Interval > 0 {
+		b.tokens += float64(now.Sub(b.updated)) / float64(l.Interval)
+	} else {
+		b.tokens = float64(l.Burst)
+	}
+	if b.tokens > float64(l.Burst) {
+		b.tokens = float64(l.Burst)
+	}
+	b.updated = now
+	return b
+}
+
+// reserve takes a notification from the empty bucket and returns the time it
+// will be available.
+func (l *RateLimiter) reserve(b *bucket, now time.Time) time.Time {
+	b.tokens--
+	return now.Add(time.Duration(-b.tokens * float64(l.Interval)))
+}
+
+// sweep removes idle buckets. It is called with the lock held.
+func (l *RateLimiter) sweep(now time.Time) {
+	if l.IdleTimeout <= 0 || now.Sub(l.swept) < l.IdleTimeout {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if len(b.pending) > 0 || now.Sub(b.updated) < l.IdleTimeout {
+			continue
+		}
+		if l.Interval > 0 && b.tokens+float64(now.Sub(b.updated))/
+			float64(l.Interval) < float64(l.Burst) {
+			continue
+		}
+		delete(l.buckets, key)
+	}
+}
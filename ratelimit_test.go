@@ -0,0 +1,141 @@
+package apns
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countSender counts sent notifications.
+type countSender struct {
+	count int32
+}
+
+func (s *countSender) Send(ctx context.Context, n Notification) (Result, error) {
+	atomic.AddInt32(&s.count, 1)
+	return Result{Token: n.Token, ID: n.ID, Attempts: 1}, nil
+}
+
+func (s *countSender) sent() int {
+	return int(atomic.LoadInt32(&s.count))
+}
+
+func TestRateLimiterDrop(t *testing.T) {
+	var sender = new(countSender)
+	limiter := NewRateLimiter(time.Hour, 2, LimitDrop)
+	limited := limiter.Middleware(sender)
+	n := Notification{Token: testToken}
+	for i := 0; i < 3; i++ {
+		_, err := limited.Send(context.Background(), n)
+		if i < 2 && err != nil {
+			t.Error(err)
+		}
+		if i == 2 {
+			if err, ok := err.(*Error); !ok || err.Reason != "TooManyRequests" {
+				t.Error("bad drop error:", err)
+			}
+		}
+	}
+	// another topic has its own bucket
+	n.Topic = "com.example.app"
+	if _, err := limited.Send(context.Background(), n); err != nil {
+		t.Error(err)
+	}
+	if sender.sent() != 3 {
+		t.Error("bad sent count:", sender.sent())
+	}
+}
+
+func TestRateLimiterDelay(t *testing.T) {
+	var sender = new(countSender)
+	limiter := NewRateLimiter(20*time.Millisecond, 1, LimitDelay)
+	limited := limiter.Middleware(sender)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := limited.Send(context.Background(),
+			Notification{Token: testToken}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Error("notifications are not delayed:", elapsed)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err := limited.Send(ctx, Notification{Token: testToken})
+	if err != context.DeadlineExceeded {
+		t.Error("bad context error:", err)
+	}
+}
+
+func TestRateLimiterCoalesce(t *testing.T) {
+	var sender = new(countSender)
+	limiter := NewRateLimiter(50*time.Millisecond, 1, LimitCoalesce)
+	limited := limiter.Middleware(sender)
+	n := Notification{Token: testToken, CollapseID: "score"}
+	if _, err := limited.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg        sync.WaitGroup
+		coalesced int32
+	)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := limited.Send(context.Background(), n); err == ErrCoalesced {
+				atomic.AddInt32(&coalesced, 1)
+			} else if err != nil {
+				t.Error(err)
+			}
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+	if coalesced != 2 || sender.sent() != 2 {
+		t.Error("bad coalescing:", coalesced, sender.sent())
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := NewRateLimiter(time.Millisecond, 1, LimitDrop)
+	limiter.IdleTimeout = 10 * time.Millisecond
+	limited := limiter.Middleware(new(countSender))
+	limited.Send(context.Background(), Notification{Token: "01"})
+	limited.Send(context.Background(), Notification{Token: "02"})
+	if limiter.Len() != 2 {
+		t.Error("bad buckets count:", limiter.Len())
+	}
+	time.Sleep(20 * time.Millisecond)
+	limited.Send(context.Background(), Notification{Token: "03"})
+	if limiter.Len() != 1 {
+		t.Error("idle buckets are not removed:", limiter.Len())
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	for _, policy := range []LimitPolicy{LimitDelay, LimitCoalesce} {
+		limiter := NewRateLimiter(time.Hour, 1, policy)
+		limited := limiter.Middleware(new(countSender))
+		n := Notification{Token: testToken, CollapseID: "score"}
+		if _, err := limited.Send(context.Background(), n); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		_, err := limited.Send(ctx, n)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("policy %d: bad error: %v", policy, err)
+		}
+		limiter.mu.Lock()
+		b := limiter.buckets[testToken+"\x00"]
+		if len(b.pending) != 0 || b.tokens < -0.01 {
+			t.Errorf("policy %d: the canceled reservation is kept: %v %v", policy,
+				b.tokens, b.pending)
+		}
+		limiter.mu.Unlock()
+	}
+}
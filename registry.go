@@ -0,0 +1,325 @@
+package apns
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Registry errors.
+var (
+	ErrTenantExists      = errors.New("tenant already exists")
+	ErrTenantCredentials = errors.New("tenant has no certificate or provider token")
+)
+
+// Tenant describes an app or a team of apps sending notifications through the
+// Registry with its own credentials.
+type Tenant struct {
+	Name        string           // unique tenant name
+	Topics      []string         // bundle IDs of the tenant apps
+	Certificate *tls.Certificate // provider certificate
+	Token       *ProviderToken   // provider token, if no certificate
+	Development bool             // use the development server
+
+	Metrics       MetricsCollector // collector of the tenant metrics
+	RateLimiter   *RateLimiter     // rate limiter of the tenant devices
+	MaxConcurrent int              // limit of concurrent sends; 0 — unlimited
+}
+
+// credentials returns the key of the tenant credentials and environment. The
+// tenants with the same key share the Client.
+func (t *Tenant) credentials() string {
+	var key string
+	switch {
+	case t.Certificate != nil && len(t.Certificate.Certificate) > 0:
+		sum := sha256.Sum256(t.Certificate.Certificate[0])
+		key = "cert:" + hex.EncodeToString(sum[:])
+	case t.Token != nil:
+		key = "token:" + t.Token.String()
+	}
+	if t.Development {
+		key += ":development"
+	}
+	return key
+}
+
+// Registry routes notifications to the clients of many apps and teams by the
+// notification topic. It implements the Sender interface.
+//
+// The clients are created on the first notification and shared by the
+// tenants with the same credentials and environment. Tenants may be added and
+// removed at any time.
+type Registry struct {
+	mu      sync.RWMutex
+	tenants map[string]*registryTenant // by name
+	topics  map[string]*registryTenant // by topic
+	clients map[string]*registryClient // by credentials
+	// newClient returns the client for the tenant credentials
+	newClient func(t *Tenant) *Client
+}
+
+// registryTenant is a tenant with its sender.
+type registryTenant struct {
+	Tenant
+	credentials string
+	once        sync.Once
+	sender      Sender
+}
+
+// registryClient is a client shared by tenants.
+type registryClient struct {
+	client *Client
+	users  int // number of tenants using the client
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		tenants:   make(map[string]*registryTenant),
+		topics:    make(map[string]*registryTenant),
+		clients:   make(map[string]*registryClient),
+		newClient: newTenantClient,
+	}
+}
+
+// newTenantClient returns a new client with the tenant credentials.
+func newTenantClient(t *Tenant) *Client {
+	var client *Client
+	if t.Certificate != nil {
+		client = New(*t.Certificate)
+	} else {
+		client = NewWithToken(t.Token)
+	}
+	if t.Development {
+		client.Host = DevelopmentHost
+	}
+	return client
+}
+
+// Add adds the tenant to the registry.
+func (r *Registry) Add(t Tenant) error {
+	if t.Certificate == nil && t.Token == nil {
+		return ErrTenantCredentials
+	}
+	if len(t.Topics) == 0 && t.Certificate != nil {
+		if info := GetCertificateInfo(t.Certificate); info != nil {
+			t.Topics = info.Topics
+			if len(t.Topics) == 0 && info.BundleID != "" {
+				t.Topics = []string{info.BundleID}
+			}
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tenants[t.Name]; ok {
+		return ErrTenantExists
+	}
+	for _, topic := range t.Topics {
+		if other, ok := r.topics[topic]; ok {
+			return fmt.Errorf("topic %s already belongs to tenant %s",
+				topic, other.Name)
+		}
+	}
+	tenant := &registryTenant{Tenant: t, credentials: t.credentials()}
+	r.tenants[t.Name] = tenant
+	for _, topic := range t.Topics {
+		r.topics[topic] = tenant
+	}
+	return nil
+}
+
+// Remove removes the tenant from the registry. The connections of the tenant
+// are closed if no other tenant shares them.
+func (r *Registry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant, ok := r.tenants[name]
+	if !ok {
+		return false
+	}
+	delete(r.tenants, name)
+	for _, topic := range tenant.Topics {
+		delete(r.topics, topic)
+	}
+	if shared, ok := r.clients[tenant.credentials]; ok && tenant.sender != nil {
+		if shared.users--; shared.users == 0 {
+			delete(r.clients, tenant.credentials)
+			shared.client.Close()
+		}
+	}
+	return true
+}
+
+// Tenants returns the names of the registered tenants.
+func (r *Registry) Tenants() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.tenants))
+	for name := range r.tenants {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Send sends the notification with the client of the tenant serving the
+// notification topic. The notification without the topic returns the
+// MissingTopic error, and the notification with an unknown topic returns the
+// TopicDisallowed error.
+func (r *Registry) Send(ctx context.Context, n Notification) (Result, error) {
+	if n.Topic == "" {
+		return Result{Token: n.Token},
+			&Error{Status: http.StatusBadRequest, Reason: "MissingTopic"}
+	}
+	r.mu.RLock()
+	tenant, ok := r.topics[n.Topic]
+	if !ok {
+		tenant, ok = r.topics[bundleID(n.Topic)]
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return Result{Token: n.Token},
+			&Error{Status: http.StatusBadRequest, Reason: "TopicDisallowed"}
+	}
+	tenant.once.Do(func() { r.connect(tenant) })
+	if tenant.sender == nil { // removed before connected
+		return Result{Token: n.Token},
+			&Error{Status: http.StatusBadRequest, Reason: "TopicDisallowed"}
+	}
+	return tenant.sender.Send(ctx, n)
+}
+
+// connect creates or shares the client for the tenant and wraps it with the
+// tenant middleware. The tenant removed after it was found by Send gets no
+// client.
+func (r *Registry) connect(tenant *registryTenant) {
+	var middleware []Middleware
+	if tenant.Metrics != nil {
+		middleware = append(middleware, Metrics(tenant.Metrics))
+	}
+	if tenant.RateLimiter != nil {
+		middleware = append(middleware, tenant.RateLimiter.Middleware)
+	}
+	if tenant.MaxConcurrent > 0 {
+		middleware = append(middleware, Concurrency(tenant.MaxConcurrent))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tenants[tenant.Name] != tenant {
+		return
+	}
+	shared, ok := r.clients[tenant.credentials]
+	if !ok {
+		shared = &registryClient{client: r.newClient(&tenant.Tenant)}
+		r.clients[tenant.credentials] = shared
+	}
+	shared.users++
+	tenant.sender = Chain(shared.client, middleware...)
+}
+
+// topicSuffixes lists the suffixes added to the bundle ID for the special
+// notification types.
+var topicSuffixes = []string{
+	PushToTalkTopicSuffix, VoIPTopicSuffix, ".complication",
+	".pushkit.fileprovider", LiveActivityTopicSuffix,
+}
+
+// bundleID returns the bundle ID of the topic without the suffix of the
+// notification type.
+func bundleID(topic string) string {
+	for _, suffix := range topicSuffixes {
+		if strings.HasSuffix(topic, suffix) {
+			return strings.TrimSuffix(topic, suffix)
+		}
+	}
+	return topic
+}
+
+// TenantConfig describes the tenant in the registry configuration file.
+type TenantConfig struct {
+	Name        string   `json:"name"`
+	Topics      []string `json:"topics,omitempty"`
+	Certificate string   `json:"certificate,omitempty"` // .p12 file name
+	Password    string   `json:"password,omitempty"`    // certificate password
+	TeamID      string   `json:"teamId,omitempty"`
+	KeyID       string   `json:"keyId,omitempty"`
+	KeyFile     string   `json:"keyFile,omitempty"` // .p8 file name
+	Development bool     `json:"development,omitempty"`
+	// MaxConcurrent limits the number of concurrent sends of the tenant.
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+}
+
+// Tenant returns the tenant with the loaded credentials.
+func (c *TenantConfig) Tenant() (*Tenant, error) {
+	var tenant = &Tenant{
+		Name:          c.Name,
+		Topics:        c.Topics,
+		Development:   c.Development,
+		MaxConcurrent: c.MaxConcurrent,
+	}
+	var err error
+	switch {
+	case c.Certificate != "":
+		tenant.Certificate, err = LoadCertificate(c.Certificate, c.Password)
+	case c.KeyFile != "":
+		if tenant.Token, err = NewProviderToken(c.TeamID, c.KeyID); err == nil {
+			err = tenant.Token.LoadPrivateKey(c.KeyFile)
+		}
+	default:
+		err = ErrTenantCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %v", c.Name, err)
+	}
+	return tenant, nil
+}
+
+// LoadConfig adds the tenants described in the JSON configuration:
+//
+//	{"tenants": [
+//	  {"name": "app", "certificate": "cert.p12", "password": "secret"},
+//	  {"name": "team", "topics": ["com.example.app", "com.example.chat"],
+//	   "teamId": "W23G28NPJW", "keyId": "67XV3VSJ95",
+//	   "keyFile": "AuthKey_67XV3VSJ95.p8", "maxConcurrent": 100}
+//	]}
+func (r *Registry) LoadConfig(config io.Reader) error {
+	var data struct {
+		Tenants []TenantConfig `json:"tenants"`
+	}
+	if err := json.NewDecoder(config).Decode(&data); err != nil {
+		return err
+	}
+	for _, config := range data.Tenants {
+		tenant, err := config.Tenant()
+		if err != nil {
+			return err
+		}
+		if err = r.Add(*tenant); err != nil {
+			return fmt.Errorf("tenant %s: %v", config.Name, err)
+		}
+	}
+	return nil
+}
+
+// LoadRegistry returns the Registry with the tenants from the JSON
+// configuration file.
+func LoadRegistry(filename string) (*Registry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	registry := NewRegistry()
+	if err = registry.LoadConfig(file); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
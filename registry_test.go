@@ -0,0 +1,135 @@
+package apns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	server := newFakeAPNs(t)
+	registry := NewRegistry()
+	var clients int
+	registry.newClient = func(tenant *Tenant) *Client {
+		clients++
+		return server.client(t)
+	}
+	pt, err := NewProviderToken("W23G28NPJW", "67XV3VSJ95")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := new(testCollector)
+	for _, tenant := range []Tenant{
+		{Name: "app", Topics: []string{"com.example.app"}, Token: pt,
+			Metrics: metrics, MaxConcurrent: 1},
+		{Name: "chat", Topics: []string{"com.example.chat"}, Token: pt},
+		{Name: "beta", Topics: []string{"com.example.beta"}, Token: pt,
+			Development: true},
+	} {
+		if err := registry.Add(tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.Add(Tenant{Name: "app", Token: pt}); err != ErrTenantExists {
+		t.Error("bad duplicate tenant error:", err)
+	}
+	if err := registry.Add(Tenant{Name: "other", Token: pt,
+		Topics: []string{"com.example.app"}}); err == nil {
+		t.Error("duplicate topic is added")
+	}
+	if err := registry.Add(Tenant{Name: "none"}); err != ErrTenantCredentials {
+		t.Error("bad credentials error:", err)
+	}
+
+	ctx := context.Background()
+	for _, topic := range []string{"com.example.app", "com.example.app.voip",
+		"com.example.chat", "com.example.beta"} {
+		if _, err := registry.Send(ctx, Notification{Token: testToken,
+			Topic: topic, Payload: `{"aps":{}}`}); err != nil {
+			t.Error(topic, err)
+		}
+	}
+	// production tenants share the client
+	if clients != 2 {
+		t.Error("bad clients count:", clients)
+	}
+	if metrics.count != 2 {
+		t.Error("bad tenant metrics:", metrics.count)
+	}
+	_, err = registry.Send(ctx, Notification{Token: testToken,
+		Topic: "com.example.unknown"})
+	if err, ok := err.(*Error); !ok || err.Reason != "TopicDisallowed" {
+		t.Error("bad unknown topic error:", err)
+	}
+	_, err = registry.Send(ctx, Notification{Token: testToken})
+	if err, ok := err.(*Error); !ok || err.Reason != "MissingTopic" {
+		t.Error("bad missing topic error:", err)
+	}
+
+	if !registry.Remove("chat") || registry.Remove("chat") {
+		t.Error("bad tenant removing")
+	}
+	_, err = registry.Send(ctx, Notification{Token: testToken,
+		Topic: "com.example.chat"})
+	if err, ok := err.(*Error); !ok || err.Reason != "TopicDisallowed" {
+		t.Error("removed tenant is used:", err)
+	}
+	if len(registry.Tenants()) != 2 {
+		t.Error("bad tenants:", registry.Tenants())
+	}
+
+	// the tenant is removed while Send connects it
+	other, err := NewProviderToken("W23G28NPJW", "ABCDE12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Add(Tenant{Name: "late", Token: other,
+		Topics: []string{"com.example.late"}}); err != nil {
+		t.Fatal(err)
+	}
+	late := registry.tenants["late"]
+	registry.Remove("late")
+	late.once.Do(func() { registry.connect(late) })
+	if _, ok := registry.clients[late.credentials]; ok || late.sender != nil {
+		t.Error("removed tenant is connected")
+	}
+}
+
+func TestRegistryConfig(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "AuthKey_67XV3VSJ95.p8")
+	err = ioutil.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry()
+	err = registry.LoadConfig(strings.NewReader(`{"tenants": [
+		{"name": "team", "topics": ["com.example.app", "com.example.chat"],
+		 "teamId": "W23G28NPJW", "keyId": "67XV3VSJ95",
+		 "keyFile": "` + keyFile + `", "maxConcurrent": 10}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := registry.Tenants(); len(names) != 1 || names[0] != "team" {
+		t.Error("bad tenants:", names)
+	}
+	err = registry.LoadConfig(strings.NewReader(`{"tenants": [{"name": "bad"}]}`))
+	if err == nil {
+		t.Error("tenant without credentials is loaded")
+	}
+}
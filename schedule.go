@@ -0,0 +1,201 @@
+package apns
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrExpired is returned in the Response for a scheduled notification whose
+// Expiration passed before the time it was scheduled to be sent.
+var ErrExpired = errors.New("notification expired before sending")
+
+// expired returns true if the Expiration of the notification passes before
+// the time.
+func (n *Notification) expired(at time.Time) bool {
+	return !n.Expiration.IsZero() && !n.Expiration.Equal(ExpireNow) &&
+		n.Expiration.Before(at)
+}
+
+// PushAt queues the notification to the APN service at the specified time.
+func (p *ClientsPool) PushAt(n Notification, at time.Time, tokens ...string) {
+	p.Schedule("", at, n, tokens...)
+}
+
+// PushAfter queues the notification to the APN service after the delay.
+func (p *ClientsPool) PushAfter(delay time.Duration, n Notification,
+	tokens ...string) {
+	p.Schedule("", time.Now().Add(delay), n, tokens...)
+}
+
+// Schedule queues the notification to the APN service at the specified time.
+// Notifications scheduled with a non-empty key can be canceled with Cancel
+// before they are sent.
+//
+// Notifications are kept in memory until the time comes. If the notification
+// Expiration passes before that, the notification is dropped and the
+// response with ErrExpired is sent to the responses channel.
+func (p *ClientsPool) Schedule(key string, at time.Time, n Notification,
+	tokens ...string) {
+	p.scheduler.add(key, at, n, tokens)
+}
+
+// Cancel removes the scheduled notifications with the key and returns their
+// number.
+func (p *ClientsPool) Cancel(key string) int {
+	return p.scheduler.cancel(key)
+}
+
+// scheduled is a notification waiting to be sent.
+type scheduled struct {
+	key          string
+	at           time.Time
+	notification Notification
+	tokens       []string
+	index        int // index in the heap
+}
+
+// scheduleHeap is a min-heap of the scheduled notifications by time.
+type scheduleHeap []*scheduled
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *scheduleHeap) Push(x interface{}) {
+	item := x.(*scheduled)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// scheduler keeps the scheduled notifications of the pool and queues them
+// when their time comes.
+type scheduler struct {
+	pool   *ClientsPool
+	mu     sync.Mutex
+	items  scheduleHeap
+	keys   map[string]map[*scheduled]struct{}
+	timer  *time.Timer
+	closed bool
+}
+
+// add schedules the notification.
+func (s *scheduler) add(key string, at time.Time, n Notification, tokens []string) {
+	if n.expired(at) {
+		// do not block the caller on the responses channel
+		go s.pool.expired(n, append([]string(nil), tokens...))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	item := &scheduled{key: key, at: at, notification: n,
+		tokens: append([]string(nil), tokens...)}
+	heap.Push(&s.items, item)
+	if key != "" {
+		if s.keys == nil {
+			s.keys = make(map[string]map[*scheduled]struct{})
+		}
+		if s.keys[key] == nil {
+			s.keys[key] = make(map[*scheduled]struct{})
+		}
+		s.keys[key][item] = struct{}{}
+	}
+	if item.index == 0 {
+		s.reset()
+	}
+}
+
+// cancel removes the notifications with the key.
+func (s *scheduler) cancel(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.keys[key]
+	for item := range items {
+		heap.Remove(&s.items, item.index)
+	}
+	delete(s.keys, key)
+	s.reset()
+	return len(items)
+}
+
+// reset sets the timer to the time of the nearest notification. It is called
+// with the lock held.
+func (s *scheduler) reset() {
+	if len(s.items) == 0 {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		return
+	}
+	delay := time.Until(s.items[0].at)
+	if s.timer == nil {
+		s.timer = time.AfterFunc(delay, s.fire)
+	} else {
+		s.timer.Reset(delay)
+	}
+}
+
+// fire queues the notifications whose time has come.
+func (s *scheduler) fire() {
+	var due []*scheduled
+	s.mu.Lock()
+	now := time.Now()
+	for len(s.items) > 0 && !s.items[0].at.After(now) {
+		item := heap.Pop(&s.items).(*scheduled)
+		if item.key != "" {
+			delete(s.keys[item.key], item)
+			if len(s.keys[item.key]) == 0 {
+				delete(s.keys, item.key)
+			}
+		}
+		due = append(due, item)
+	}
+	if !s.closed {
+		s.reset()
+	}
+	s.mu.Unlock()
+	for _, item := range due {
+		n := item.notification
+		if n.expired(now) {
+			s.pool.expired(n, item.tokens)
+			continue
+		}
+		// the lock is not held: pushing waits for a free worker, and the
+		// closed pool drops the notification
+		s.pool.Push(n, item.tokens...)
+	}
+}
+
+// close drops all scheduled notifications.
+func (s *scheduler) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.items, s.keys = nil, nil
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.mu.Unlock()
+}
+
+// expired reports the expired notifications to the responses channel.
+func (p *ClientsPool) expired(n Notification, tokens []string) {
+	if p.responses == nil {
+		return
+	}
+	for _, token := range tokens {
+		p.responses <- Response{Token: token, ID: n.ID, Error: ErrExpired}
+	}
+}
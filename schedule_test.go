@@ -0,0 +1,93 @@
+package apns
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoolSchedule(t *testing.T) {
+	sender := new(countSender)
+	responses := make(chan Response, 10)
+	pool := NewPool(sender, 1, responses)
+	defer pool.Close()
+	n := Notification{Payload: `{"aps":{"alert":"Reminder"}}`}
+	pool.PushAfter(20*time.Millisecond, n, "01")
+	pool.PushAt(n, time.Now().Add(10*time.Millisecond), "02", "03")
+	pool.Schedule("quiet", time.Now().Add(5*time.Millisecond), n, "04")
+	if count := pool.Cancel("quiet"); count != 1 {
+		t.Error("bad canceled count:", count)
+	}
+	// expires before the send time
+	n.Expiration = time.Now().Add(time.Millisecond)
+	pool.PushAfter(time.Hour, n, "05")
+
+	var order []string
+	for i := 0; i < 4; i++ {
+		select {
+		case r := <-responses:
+			if r.Token == "05" {
+				if r.Error != ErrExpired {
+					t.Error("bad expired error:", r.Error)
+				}
+				continue
+			}
+			if r.Error != nil {
+				t.Error(r.Error)
+			}
+			order = append(order, r.Token)
+		case <-time.After(time.Second):
+			t.Fatal("scheduled notifications are not sent")
+		}
+	}
+	if len(order) != 3 || order[2] != "01" {
+		t.Error("bad order:", order)
+	}
+	if sender.sent() != 3 {
+		t.Error("bad sent count:", sender.sent())
+	}
+}
+
+func TestPoolScheduleClose(t *testing.T) {
+	responses := make(chan Response)
+	pool := NewPool(new(countSender), 1, responses)
+	// the expired notification does not wait for the responses reader
+	n := Notification{Expiration: time.Now().Add(time.Millisecond)}
+	pool.PushAfter(time.Hour, n, "01")
+	go func() {
+		for range responses {
+		}
+	}()
+	// the notifications are due while the pool is closing
+	n.Expiration = time.Time{}
+	for i := 0; i < 100; i++ {
+		pool.PushAfter(0, n, "02")
+	}
+	pool.Close()
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestPoolScheduleBusy(t *testing.T) {
+	release := make(chan struct{})
+	busy := SenderFunc(func(ctx context.Context, n Notification) (Result, error) {
+		<-release
+		return Result{Token: n.Token}, nil
+	})
+	pool := NewPool(busy, 1, nil)
+	defer close(release)
+	pool.Push(Notification{}, "01") // the only worker is busy
+	pool.PushAfter(0, Notification{}, "02")
+	time.Sleep(10 * time.Millisecond) // the scheduled notification waits
+	done := make(chan struct{})
+	go func() {
+		pool.Schedule("later", time.Now().Add(time.Hour), Notification{}, "03")
+		pool.Cancel("later")
+		pool.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the pool is blocked by the scheduled notification")
+	}
+}
@@ -0,0 +1,63 @@
+package apns
+
+import "context"
+
+// Result describes the result of sending a notification to APNs.
+type Result struct {
+	Token    string // Unique device token for the app.
+	ID       string // A canonical UUID that identifies the notification
+	Attempts int    // Number of attempts made to send the notification
+}
+
+// Sender is the interface implemented by anything that can deliver a
+// notification to APNs: Client, ClientsPool and the middleware wrapped around
+// them.
+//
+// Send returns the APNs response for the notification. If APNs rejects the
+// notification, the returned error is *Error.
+type Sender interface {
+	Send(ctx context.Context, n Notification) (Result, error)
+}
+
+// SenderFunc is an adapter to allow the use of ordinary functions as Sender.
+type SenderFunc func(ctx context.Context, n Notification) (Result, error)
+
+// Send calls f(ctx, n).
+func (f SenderFunc) Send(ctx context.Context, n Notification) (Result, error) {
+	return f(ctx, n)
+}
+
+// Middleware wraps a Sender with an additional behavior such as logging,
+// validation, metrics or retries.
+type Middleware func(Sender) Sender
+
+// Chain wraps the sender with the middleware. The first middleware is the
+// outermost one: it sees the notification first and the result last.
+func Chain(sender Sender, middleware ...Middleware) Sender {
+	var chain = chained{Sender: sender, base: sender}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		chain.Sender = middleware[i](chain.Sender)
+	}
+	return chain
+}
+
+// chained is a sender wrapped with middleware, which remembers the original
+// sender.
+type chained struct {
+	Sender        // the outermost middleware
+	base   Sender // the wrapped sender
+}
+
+// baseClient returns the Client at the base of the sender chain or nil.
+func baseClient(sender Sender) *Client {
+	for {
+		switch s := sender.(type) {
+		case *Client:
+			return s
+		case chained:
+			sender = s.base
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package apns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAPNs is a local HTTP/2 server imitating the APNs Provider API.
+type fakeAPNs struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request // received requests
+	bodies   [][]byte        // received request bodies
+	// reply returns the status and the reason for the request; 200 by default
+	reply func(r *http.Request) (status int, reason string)
+	// channels are the broadcast channels by ID
+	channels map[string]Channel
+}
+
+// newFakeAPNs starts the fake APNs server.
+func newFakeAPNs(t testing.TB) *fakeAPNs {
+	f := new(fakeAPNs)
+	f.Server = httptest.NewUnstartedServer(http.HandlerFunc(f.serveHTTP))
+	f.EnableHTTP2 = true
+	f.StartTLS()
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAPNs) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, body)
+	reply := f.reply
+	f.mu.Unlock()
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/1/apps/"):
+		f.serveChannels(w, r, body)
+		return
+	case strings.HasPrefix(r.URL.Path, "/4/broadcasts/apps/"):
+		f.mu.Lock()
+		_, ok := f.channels[r.Header.Get("apns-channel-id")]
+		f.mu.Unlock()
+		if !ok {
+			reply = func(*http.Request) (int, string) {
+				return http.StatusBadRequest, "BadChannelId"
+			}
+		}
+		w.Header().Set("apns-request-id", "11111111-1111-1111-1111-111111111111")
+	}
+	id := r.Header.Get("apns-id")
+	if id == "" {
+		id = "00000000-0000-0000-0000-000000000000"
+	}
+	w.Header().Set("apns-id", id)
+	status, reason := http.StatusOK, ""
+	switch {
+	case reply != nil:
+		status, reason = reply(r)
+	case !strings.HasPrefix(r.URL.Path, "/3/device/") &&
+		!strings.HasPrefix(r.URL.Path, "/4/broadcasts/apps/"):
+		status, reason = http.StatusNotFound, "BadPath"
+	}
+	w.WriteHeader(status)
+	if status != http.StatusOK {
+		json.NewEncoder(w).Encode(map[string]string{"reason": reason})
+	}
+}
+
+// serveChannels imitates the broadcast channel management API.
+func (f *fakeAPNs) serveChannels(w http.ResponseWriter, r *http.Request,
+	body []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.channels == nil {
+		f.channels = make(map[string]Channel)
+	}
+	id := r.Header.Get("apns-channel-id")
+	channel, ok := f.channels[id]
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/channels"):
+		if err := json.Unmarshal(body, &channel); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		channel.ID = fmt.Sprintf("channel-%d", len(f.requests))
+		f.channels[channel.ID] = channel
+		w.Header().Set("apns-channel-id", channel.ID)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/all-channels"):
+		var list struct {
+			Channels []string `json:"channels"`
+		}
+		for id := range f.channels {
+			list.Channels = append(list.Channels, id)
+		}
+		json.NewEncoder(w).Encode(list)
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"reason": "ChannelNotRegistered"})
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(channel)
+	case r.Method == http.MethodDelete:
+		delete(f.channels, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"reason": "MethodNotAllowed"})
+	}
+}
+
+// count returns the number of received requests.
+func (f *fakeAPNs) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+// last returns the last received request and its body.
+func (f *fakeAPNs) last() (*http.Request, []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		return nil, nil
+	}
+	return f.requests[len(f.requests)-1], f.bodies[len(f.bodies)-1]
+}
+
+// client returns a Client connected to the server.
+func (f *fakeAPNs) client(t testing.TB) *Client {
+	return &Client{Host: f.URL, httpСlient: f.httpClient()}
+}
+
+// httpClient returns the HTTP client trusting the server with its own
+// transport, so changing the transport of one Client does not affect others.
+func (f *fakeAPNs) httpClient() *http.Client {
+	client := *f.Client()
+	client.Transport = client.Transport.(*http.Transport).Clone()
+	return &client
+}
+
+const testToken = "BE311B5BADA725B323B1A56E03ED25B4814D6B9EDF5B02D3D605840860FEBB28"
@@ -0,0 +1,157 @@
+package apns
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// ErrTemplatePayload is returned for the template notification without the
+// typed Payload.
+var ErrTemplatePayload = errors.New("template notification without typed payload")
+
+// Template is the notification personalized for each recipient. The alert
+// title, subtitle and body and the string custom values of its Payload are
+// text/template templates rendered with the variables of the recipient:
+//
+//	Hello, {{.Name}}! You have {{.Count}} new messages.
+//
+// The rendered texts are the values of the payload, not the JSON source, so
+// any variable values keep the payload valid JSON. The rendered payload
+// exceeding the size limit gets the alert trimmed with the Ellipsis.
+type Template struct {
+	Ellipsis string // the end of the trimmed alert text
+
+	notification Notification
+	payload      *Payload
+	alert        [3]*template.Template // title, subtitle and body
+	custom       map[string]*template.Template
+}
+
+// NewTemplate compiles the templates of the notification with the typed
+// Payload and checks the size of the payload with the template source. The
+// Token of the notification is replaced by the recipient token.
+func NewTemplate(n Notification) (*Template, error) {
+	payload, ok := n.typedPayload()
+	if !ok {
+		return nil, ErrTemplatePayload
+	}
+	data, err := payload.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > n.maxPayloadSize() {
+		return nil, &Error{Status: http.StatusRequestEntityTooLarge,
+			Reason: "PayloadTooLarge"}
+	}
+	t := &Template{
+		Ellipsis:     "…",
+		notification: n,
+		payload:      payload,
+		custom:       make(map[string]*template.Template),
+	}
+	if alert := payload.APS.Alert; alert != nil {
+		for i, text := range []string{alert.Title, alert.Subtitle, alert.Body} {
+			if t.alert[i], err = parseTemplate("alert", text); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for key, value := range payload.Custom {
+		if text, ok := value.(string); ok {
+			tmpl, err := parseTemplate(key, text)
+			if err != nil {
+				return nil, err
+			}
+			if tmpl != nil {
+				t.custom[key] = tmpl
+			}
+		}
+	}
+	return t, nil
+}
+
+// parseTemplate returns the compiled template of the text or nil, if the
+// text is not a template.
+func parseTemplate(name, text string) (*template.Template, error) {
+	if !strings.Contains(text, "{{") {
+		return nil, nil
+	}
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// execute returns the rendered text or the source text, if it is not a
+// template.
+func execute(tmpl *template.Template, text string, vars interface{}) (
+	string, error) {
+	if tmpl == nil {
+		return text, nil
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Render returns the notification to the device token with the templates
+// rendered with the variables: a map or a struct.
+func (t *Template) Render(token string, vars interface{}) (Notification, error) {
+	n := t.notification
+	n.Token = token
+	payload := *t.payload
+	if alert := payload.APS.Alert; alert != nil {
+		var (
+			rendered = &Alert{}
+			texts    = [3]*string{&rendered.Title, &rendered.Subtitle, &rendered.Body}
+			err      error
+		)
+		*rendered = *alert // keep the localization keys
+		for i, text := range []string{alert.Title, alert.Subtitle, alert.Body} {
+			if *texts[i], err = execute(t.alert[i], text, vars); err != nil {
+				return n, err
+			}
+		}
+		payload.APS.Alert = rendered
+	}
+	if len(t.custom) > 0 {
+		payload.Custom = make(map[string]interface{}, len(t.payload.Custom))
+		for key, value := range t.payload.Custom {
+			if tmpl := t.custom[key]; tmpl != nil {
+				text, err := execute(tmpl, "", vars)
+				if err != nil {
+					return n, err
+				}
+				value = text
+			}
+			payload.Custom[key] = value
+		}
+	}
+	n.Payload = &payload
+	_, err := n.Fit(t.Ellipsis)
+	return n, err
+}
+
+// Recipient is the device token with the variables of the template.
+type Recipient struct {
+	Token string
+	Vars  interface{}
+}
+
+// PushTemplate queues the notifications rendered from the template for each
+// recipient, like Push does for the multicast notification. The notification
+// that cannot be rendered is not sent, and the response with the error is sent
+// to the responses channel.
+func (p *ClientsPool) PushTemplate(t *Template, recipients ...Recipient) {
+	for _, recipient := range recipients {
+		n, err := t.Render(recipient.Token, recipient.Vars)
+		if err != nil {
+			if p.responses != nil {
+				p.responses <- Response{recipient.Token, n.ID, err}
+			}
+			continue
+		}
+		p.Push(n, recipient.Token)
+	}
+}
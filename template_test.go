@@ -0,0 +1,92 @@
+package apns
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	tmpl, err := NewTemplate(Notification{
+		Topic: "com.example.app",
+		Payload: &Payload{
+			APS: APS{Alert: &Alert{
+				Title: "Hello, {{.Name}}!",
+				Body:  "You have {{.Count}} new messages.",
+			}},
+			Custom: map[string]interface{}{"user": "{{.Name}}", "id": 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := make(chan Response, 3)
+	sender := new(countSender)
+	pool := NewPool(sender, 1, responses)
+	defer pool.Close()
+	pool.PushTemplate(tmpl,
+		Recipient{"01", map[string]interface{}{"Name": `"Bob" <\n>`, "Count": 2}},
+		Recipient{"02", struct {
+			Name  string
+			Count int
+		}{"Alice", 1}},
+		Recipient{"03", map[string]interface{}{"Name": "Eve"}}, // no Count
+	)
+	for i := 0; i < 3; i++ {
+		r := <-responses
+		if (r.Error != nil) != (r.Token == "03") {
+			t.Error("bad response:", r)
+		}
+	}
+
+	n, err := tmpl.Render("01", map[string]string{"Name": `"Bob" <\n>`,
+		"Count": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := n.body()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		APS struct {
+			Alert Alert `json:"alert"`
+		} `json:"aps"`
+		User string `json:"user"`
+		ID   int    `json:"id"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err, string(data))
+	}
+	if payload.APS.Alert.Title != `Hello, "Bob" <\n>!` || payload.ID != 1 ||
+		payload.APS.Alert.Body != "You have 2 new messages." ||
+		payload.User != `"Bob" <\n>` {
+		t.Error("bad rendered payload:", string(data))
+	}
+
+	// the rendered payload is trimmed to fit
+	if n, err = tmpl.Render("01", map[string]interface{}{"Name": "Bob",
+		"Count": strings.Repeat("9", MaxPayloadSize)}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ = n.body(); len(data) > MaxPayloadSize {
+		t.Error("rendered payload is not trimmed:", len(data))
+	}
+
+	// templates are checked up front
+	if _, err := NewTemplate(Notification{Payload: &Payload{
+		APS: APS{Alert: &Alert{Body: "{{.Name"}}}}); err == nil {
+		t.Error("bad template is compiled")
+	}
+	if _, err := NewTemplate(Notification{Payload: &Payload{
+		APS: APS{Alert: &Alert{Body: strings.Repeat("x", MaxPayloadSize)}}}}); err == nil {
+		t.Error("too large template is compiled")
+	}
+	if _, err := NewTemplate(Notification{Payload: Payload{
+		APS: APS{Alert: &Alert{Body: "{{.Name}}"}}}}); err != nil {
+		t.Error("payload value is not compiled:", err)
+	}
+	if _, err := NewTemplate(Notification{Payload: `{}`}); err != ErrTemplatePayload {
+		t.Error("bad payload error:", err)
+	}
+}
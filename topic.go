@@ -0,0 +1,105 @@
+package apns
+
+import "net/http"
+
+// Topic describes a topic served by the Client.
+//
+// A single provider token can serve every app of the team, so one
+// token-authenticated Client with its connections may send notifications to
+// many topics at the same time. The topics added to the client are checked
+// locally: notifications to other topics are rejected without sending them to
+// APNs.
+type Topic struct {
+	Name      string   // topic, typically the bundle ID of the app
+	PushType  string   // default push type of the topic notifications
+	PushTypes []string // allowed push types; empty — any push type
+}
+
+// allows returns true if the push type is allowed for the topic.
+func (t Topic) allows(pushType string) bool {
+	if len(t.PushTypes) == 0 {
+		return true
+	}
+	if pushType == "" {
+		pushType = PushTypeAlert
+	}
+	for _, allowed := range t.PushTypes {
+		if allowed == pushType {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTopic adds the topics served by the client. Once the topics are added,
+// the client sends notifications only to them. The notification without a
+// topic is sent to the only added topic.
+//
+// The topic of the app allows the topics of its special notification types,
+// such as com.example.app.voip or com.example.app.push-type.liveactivity,
+// without checking their push types. Add such a topic to set its push types.
+func (c *Client) AddTopic(topics ...Topic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.topics == nil {
+		c.topics = make(map[string]Topic, len(topics))
+	}
+	for _, topic := range topics {
+		c.topics[topic.Name] = topic
+	}
+}
+
+// RemoveTopic removes the topic served by the client.
+func (c *Client) RemoveTopic(name string) {
+	c.mu.Lock()
+	delete(c.topics, name)
+	c.mu.Unlock()
+}
+
+// Topics returns the topics served by the client.
+func (c *Client) Topics() []Topic {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	topics := make([]Topic, 0, len(c.topics))
+	for _, topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// checkTopic checks the notification topic and push type against the topics
+// served by the client, and sets the default topic and push type.
+func (c *Client) checkTopic(n *Notification) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.topics) == 0 {
+		return nil
+	}
+	var topic Topic
+	if n.Topic == "" {
+		if len(c.topics) > 1 {
+			return &Error{Status: http.StatusBadRequest, Reason: "MissingTopic"}
+		}
+		for _, topic = range c.topics {
+			break // the only topic
+		}
+		n.Topic = topic.Name
+	} else {
+		var ok bool
+		if topic, ok = c.topics[n.Topic]; !ok {
+			// the special notification types of the app have their own
+			// push types
+			if _, ok = c.topics[bundleID(n.Topic)]; !ok {
+				return &Error{Status: http.StatusBadRequest, Reason: "TopicDisallowed"}
+			}
+			return nil
+		}
+	}
+	if n.PushType == "" {
+		n.PushType = topic.PushType
+	}
+	if !topic.allows(n.PushType) {
+		return &Error{Status: http.StatusBadRequest, Reason: "InvalidPushType"}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package apns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tokenClient returns a Client connected to the server with a provider token
+// signed by a generated key.
+func (f *fakeAPNs) tokenClient(t testing.TB) (*Client, *ecdsa.PrivateKey) {
+	pt, err := NewProviderToken("W23G28NPJW", "67XV3VSJ95")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt.privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	client := NewWithToken(pt)
+	client.Host = f.URL
+	client.httpСlient = f.httpClient()
+	return client, pt.privateKey
+}
+
+func TestClientTopics(t *testing.T) {
+	f := newFakeAPNs(t)
+	client, key := f.tokenClient(t)
+	client.AddTopic(
+		Topic{Name: "com.example.app"},
+		Topic{Name: "com.example.chat"},
+		Topic{Name: "com.example.chat.voip", PushType: PushTypeVoIP,
+			PushTypes: []string{PushTypeVoIP}},
+	)
+	if len(client.Topics()) != 3 {
+		t.Fatal("bad topics:", client.Topics())
+	}
+	var wg sync.WaitGroup
+	for _, topic := range []string{"com.example.app", "com.example.chat",
+		"com.example.chat.voip"} {
+		wg.Add(1)
+		go func(topic string) {
+			defer wg.Done()
+			_, err := client.Send(context.Background(), Notification{
+				Token: testToken, Topic: topic, Payload: `{"aps":{}}`})
+			if err != nil {
+				t.Error(topic, err)
+			}
+		}(topic)
+	}
+	wg.Wait()
+	if f.count() != 3 {
+		t.Fatal("bad requests count:", f.count())
+	}
+	f.mu.Lock()
+	for _, r := range f.requests {
+		topic, pushType := r.Header.Get("apns-topic"), r.Header.Get("apns-push-type")
+		if strings.HasSuffix(topic, ".voip") != (pushType == PushTypeVoIP) {
+			t.Error("bad push type:", topic, pushType)
+		}
+		verifyJWT(t, strings.TrimPrefix(r.Header.Get("authorization"), "bearer "), key)
+	}
+	f.mu.Unlock()
+
+	// locally rejected notifications
+	for _, test := range []struct {
+		n      Notification
+		reason string
+	}{
+		{Notification{Topic: "com.example.other"}, "TopicDisallowed"},
+		{Notification{}, "MissingTopic"},
+		{Notification{Topic: "com.example.chat.voip", PushType: PushTypeAlert},
+			"InvalidPushType"},
+	} {
+		test.n.Token, test.n.Payload = testToken, `{"aps":{}}`
+		_, err := client.Send(context.Background(), test.n)
+		if apnsErr, ok := err.(*Error); !ok || apnsErr.Reason != test.reason {
+			t.Errorf("bad error for %q: %v", test.n.Topic, err)
+		}
+	}
+	if f.count() != 3 {
+		t.Error("rejected notification is sent:", f.count())
+	}
+
+	// the only topic is the default one
+	client.RemoveTopic("com.example.chat")
+	client.RemoveTopic("com.example.chat.voip")
+	if _, err := client.Send(context.Background(), Notification{
+		Token: testToken, Payload: `{"aps":{}}`}); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := f.last(); r.Header.Get("apns-topic") != "com.example.app" {
+		t.Error("bad default topic:", r.Header.Get("apns-topic"))
+	}
+
+	// the special notification types of the app topic
+	for _, n := range []Notification{
+		{Topic: "com.example.app" + VoIPTopicSuffix, PushType: PushTypeVoIP},
+		{Topic: "com.example.app" + LiveActivityTopicSuffix,
+			PushType: PushTypeLiveActivity},
+	} {
+		n.Token, n.Payload = testToken, `{"aps":{}}`
+		if _, err := client.Send(context.Background(), n); err != nil {
+			t.Errorf("%s: %v", n.Topic, err)
+		}
+	}
+}
+
+// verifyJWT checks the signature of the provider token.
+func verifyJWT(t testing.TB, jwt string, key *ecdsa.PrivateKey) {
+	t.Helper()
+	i := strings.LastIndexByte(jwt, '.')
+	if i < 0 {
+		t.Fatal("bad JWT:", jwt)
+	}
+	sign, err := base64.RawURLEncoding.DecodeString(jwt[i+1:])
+	if err != nil || len(sign) != 64 {
+		t.Fatal("bad JWT signature:", jwt, err)
+	}
+	sum := sha256.Sum256([]byte(jwt[:i]))
+	r, s := new(big.Int).SetBytes(sign[:32]), new(big.Int).SetBytes(sign[32:])
+	if !ecdsa.Verify(&key.PublicKey, sum[:], r, s) {
+		t.Error("JWT signature is not verified:", jwt)
+	}
+}
@@ -0,0 +1,787 @@
+package apns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Transport errors.
+var (
+	ErrTransportScheme   = errors.New("apns transport supports only https requests")
+	ErrTransportProtocol = errors.New("apns server does not support HTTP/2")
+	ErrTransportClosed   = errors.New("apns connection closed")
+)
+
+// errConnUnusable is returned when the connection went away before the
+// stream was opened; the request is sent with another connection.
+var errConnUnusable = errors.New("apns connection is unusable")
+
+const (
+	transportStreams      = 100     // streams before the server settings
+	transportStreamWindow = 1 << 20 // receive window of the stream
+	transportConnWindow   = 1 << 24 // receive window of the connection
+)
+
+// Transport is the lightweight HTTP/2 transport to APNs built on the http2
+// framer. Unlike net/http, it encodes the request headers the way Apple
+// recommends, to avoid filling up the small HPACK dynamic table of APNs:
+//   - :path and authorization are never indexed;
+//   - apns-id, apns-expiration and apns-collapse-id are indexed the first
+//     time they are sent with the connection and never indexed after that;
+//   - the other headers are indexed.
+//
+// The never indexed literal is the literal header field without indexing
+// that intermediaries must not index too.
+//
+// The requests to the same host are multiplexed with one connection up to
+// the concurrent streams limit of the server. The requests not processed by
+// the server before the GOAWAY frame are resent with a new connection, unless
+// the reason is fatal; the others are failed with http2.GoAwayError with the
+// debug data of the frame.
+//
+// Use Client.EnableHPACK to send notifications with the transport.
+type Transport struct {
+	TLSClientConfig *tls.Config   // TLS configuration; h2 protocol is added
+	PingInterval    time.Duration // interval of the PING frames; 0 — disabled
+	PingTimeout     time.Duration // PING acknowledgement timeout; Timeout by default
+	// OnGoAway, if not nil, is called for the GOAWAY frame received with the
+	// connection.
+	OnGoAway func(GoAway)
+	// Proxy, if not nil, returns the proxy URL for the request like the
+	// http.Transport Proxy does: the HTTP proxy with CONNECT or SOCKS5.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	mu    sync.Mutex
+	conns map[string][]*transportConn // by proxy and host:port
+	dials map[string]*dialCall        // dials in progress by proxy and host:port
+}
+
+// dialCall is the connection dial in progress.
+type dialCall struct {
+	done chan struct{}
+	err  error
+}
+
+// EnableHPACK switches the client to the HPACK-aware HTTP/2 Transport with
+// the TLS configuration and the proxy of its current transport and returns
+// the transport. The client already using the Transport keeps it.
+func (c *Client) EnableHPACK() *Transport {
+	transport := new(Transport)
+	switch current := c.httpСlient.Transport.(type) {
+	case *Transport:
+		return current
+	case *http.Transport:
+		if current.TLSClientConfig != nil {
+			transport.TLSClientConfig = current.TLSClientConfig.Clone()
+		}
+		transport.Proxy = current.Proxy
+	}
+	if c.h2 != nil {
+		transport.PingInterval = c.h2.ReadIdleTimeout
+		transport.PingTimeout = c.h2.PingTimeout
+	}
+	transport.OnGoAway = c.goAway
+	c.httpСlient.CloseIdleConnections()
+	c.httpСlient.Transport = transport
+	return transport
+}
+
+// RoundTrip sends the request with HTTP/2 and returns the response with the
+// buffered body. It implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	if req.URL.Scheme != "https" {
+		return nil, ErrTransportScheme
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	addr := hostAddr(req.URL)
+	proxy, err := requestProxy(t.Proxy, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	for retries := 0; ; {
+		cc, err := t.conn(req.Context(), addr, proxy)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := cc.roundTrip(req, body)
+		if err == errConnUnusable {
+			continue
+		}
+		if err, ok := err.(unprocessedError); ok {
+			if retries < transportRetries && !goAwayError(err.GoAwayError).Fatal() {
+				retries++
+				continue
+			}
+			return nil, err.GoAwayError
+		}
+		return resp, err
+	}
+}
+
+// requestBody returns the request body. The pooled body is not copied.
+func requestBody(req *http.Request) ([]byte, error) {
+	switch body := req.Body.(type) {
+	case nil:
+		return nil, nil
+	case *bodyReader:
+		if body.buf == nil {
+			return nil, nil
+		}
+		return body.buf.data[body.off:], nil
+	default:
+		if body == http.NoBody {
+			return nil, nil
+		}
+		return io.ReadAll(body)
+	}
+}
+
+// conn returns the connection to the address with the free stream. The new
+// connection is established if all connections are busy.
+func (t *Transport) conn(ctx context.Context, addr string, proxy *url.URL) (
+	*transportConn, error) {
+	key := addr
+	if proxy != nil {
+		key = proxy.String() + " " + addr
+	}
+	for {
+		t.mu.Lock()
+		for _, cc := range t.conns[key] {
+			if cc.reserve() {
+				t.mu.Unlock()
+				return cc, nil
+			}
+		}
+		call := t.dials[key]
+		if call == nil {
+			if t.dials == nil {
+				t.dials = make(map[string]*dialCall)
+			}
+			call = &dialCall{done: make(chan struct{})}
+			t.dials[key] = call
+			// the dial is shared by the concurrent requests, so it is not
+			// canceled with the request that started it; dialTLS limits it
+			// with the Timeout
+			go t.dialCall(context.WithoutCancel(ctx), call, key, addr, proxy)
+		}
+		t.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+	}
+}
+
+// dialCall establishes the new connection for the dial call and adds it to
+// the connections with the key.
+func (t *Transport) dialCall(ctx context.Context, call *dialCall, key, addr string,
+	proxy *url.URL) {
+	cc, err := t.dial(ctx, addr, proxy)
+	t.mu.Lock()
+	delete(t.dials, key)
+	if err == nil {
+		cc.key = key
+		if t.conns == nil {
+			t.conns = make(map[string][]*transportConn)
+		}
+		t.conns[key] = append(t.conns[key], cc)
+	}
+	t.mu.Unlock()
+	call.err = err
+	close(call.done)
+}
+
+// dialTLS establishes the TLS connection to the address with the h2
+// protocol, through the proxy if it is not nil.
+func dialTLS(ctx context.Context, config *tls.Config, proxy *url.URL, addr string) (
+	net.Conn, error) {
+	if config == nil {
+		config = new(tls.Config)
+	} else {
+		config = config.Clone()
+	}
+	config.NextProtos = []string{http2.NextProtoTLS}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	// the timeout covers the proxy handshake and the TLS handshake
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	raw, err := dialConn(ctx, proxy, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(raw, config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	if conn.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+		conn.Close()
+		return nil, ErrTransportProtocol
+	}
+	return conn, nil
+}
+
+// hostAddr returns the host:port address of the URL.
+func hostAddr(u *url.URL) string {
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return u.Host
+}
+
+// dial establishes the new HTTP/2 connection to the address.
+func (t *Transport) dial(ctx context.Context, addr string, proxy *url.URL) (
+	*transportConn, error) {
+	conn, err := dialTLS(ctx, t.TLSClientConfig, proxy, addr)
+	if err != nil {
+		return nil, err
+	}
+	cc := &transportConn{
+		t:            t,
+		conn:         conn,
+		bw:           bufio.NewWriter(conn),
+		indexed:      make(map[string]bool, 3),
+		streams:      make(map[uint32]*clientStream),
+		nextID:       1,
+		maxStreams:   transportStreams,
+		maxFrameSize: 16384,
+		window:       65535,
+		streamWindow: 65535,
+		pings:        make(map[[8]byte]chan struct{}),
+		closed:       make(chan struct{}),
+	}
+	cc.cond = sync.NewCond(&cc.mu)
+	cc.fr = http2.NewFramer(cc.bw, bufio.NewReader(conn))
+	cc.fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	cc.henc = hpack.NewEncoder(&cc.hbuf)
+	if _, err = cc.bw.WriteString(http2.ClientPreface); err == nil {
+		err = cc.fr.WriteSettings(
+			http2.Setting{ID: http2.SettingEnablePush, Val: 0},
+			http2.Setting{ID: http2.SettingInitialWindowSize, Val: transportStreamWindow},
+		)
+		if err == nil {
+			err = cc.fr.WriteWindowUpdate(0, transportConnWindow-65535)
+		}
+		if err == nil {
+			err = cc.bw.Flush()
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go cc.readLoop()
+	t.mu.Lock()
+	interval, timeout := t.PingInterval, t.PingTimeout
+	t.mu.Unlock()
+	if interval > 0 {
+		go cc.keepAlive(interval, timeout)
+	}
+	return cc, nil
+}
+
+// removeConn removes the closed or going away connection from the pool.
+func (t *Transport) removeConn(cc *transportConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conns := t.conns[cc.key]
+	for i, c := range conns {
+		if c == cc {
+			t.conns[cc.key] = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(t.conns[cc.key]) == 0 {
+		delete(t.conns, cc.key)
+	}
+}
+
+// CloseIdleConnections closes the connections without active streams.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	var idle []*transportConn
+	for _, conns := range t.conns {
+		for _, cc := range conns {
+			cc.mu.Lock()
+			if len(cc.streams) == 0 && cc.reserved == 0 {
+				idle = append(idle, cc)
+			}
+			cc.mu.Unlock()
+		}
+	}
+	t.mu.Unlock()
+	for _, cc := range idle {
+		cc.close(ErrTransportClosed)
+	}
+}
+
+// transportConn is the HTTP/2 connection of the Transport.
+type transportConn struct {
+	t    *Transport
+	key  string // proxy and address of the connection pool
+	conn net.Conn
+
+	wmu     sync.Mutex // writing frames and encoding headers
+	bw      *bufio.Writer
+	fr      *http2.Framer
+	henc    *hpack.Encoder
+	hbuf    bytes.Buffer
+	indexed map[string]bool // headers indexed with the connection
+
+	mu           sync.Mutex
+	cond         *sync.Cond // flow control window updates
+	streams      map[uint32]*clientStream
+	nextID       uint32
+	reserved     int    // streams reserved for the requests
+	maxStreams   uint32 // concurrent streams limit of the server
+	maxFrameSize uint32 // frame size limit of the server
+	window       int32  // send window of the connection
+	streamWindow int32  // initial send window of the stream
+	goAway       *http2.GoAwayError
+	pings        map[[8]byte]chan struct{} // PING frames waiting for the ack
+	closed       chan struct{}             // closed with the connection
+	err          error                     // connection is closed
+}
+
+// clientStream is the request stream of the connection.
+type clientStream struct {
+	id     uint32
+	window int32 // send window
+	status int
+	header http.Header
+	body   bytes.Buffer
+	done   chan struct{}
+	err    error
+}
+
+// reserve reserves the stream for the request, if the connection is usable
+// and has the free stream.
+func (cc *transportConn) reserve() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.err != nil || cc.goAway != nil || cc.nextID > 1<<31-1 ||
+		uint32(len(cc.streams)+cc.reserved) >= cc.maxStreams {
+		return false
+	}
+	cc.reserved++
+	return true
+}
+
+// roundTrip sends the request with the reserved stream and waits for the
+// response.
+func (cc *transportConn) roundTrip(req *http.Request, body []byte) (
+	*http.Response, error) {
+	cc.wmu.Lock()
+	cc.mu.Lock()
+	cc.reserved--
+	if cc.err != nil || cc.goAway != nil {
+		cc.mu.Unlock()
+		cc.wmu.Unlock()
+		return nil, errConnUnusable
+	}
+	cs := &clientStream{id: cc.nextID, window: cc.streamWindow,
+		done: make(chan struct{})}
+	cc.nextID += 2
+	cc.streams[cs.id] = cs
+	cc.mu.Unlock()
+	err := cc.writeHeaders(cs.id, req, len(body))
+	cc.wmu.Unlock()
+	if err == nil && len(body) > 0 {
+		err = cc.writeData(cs, body)
+	}
+	if err != nil {
+		cc.close(err)
+	}
+	select {
+	case <-cs.done:
+	case <-req.Context().Done():
+		cc.resetStream(cs)
+		return nil, req.Context().Err()
+	}
+	if cs.err != nil {
+		return nil, cs.err
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(cs.status) + " " + http.StatusText(cs.status),
+		StatusCode:    cs.status,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        cs.header,
+		Body:          io.NopCloser(bytes.NewReader(cs.body.Bytes())),
+		ContentLength: int64(cs.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// neverIndexed are the headers indexed only the first time they are sent.
+var neverIndexed = map[string]bool{
+	"apns-id":          true,
+	"apns-expiration":  true,
+	"apns-collapse-id": true,
+}
+
+// lowerHeaders are the lower case names of the common headers.
+var lowerHeaders = map[string]string{
+	"Apns-Channel-Id":  "apns-channel-id",
+	"Apns-Collapse-Id": "apns-collapse-id",
+	"Apns-Expiration":  "apns-expiration",
+	"Apns-Id":          "apns-id",
+	"Apns-Priority":    "apns-priority",
+	"Apns-Push-Type":   "apns-push-type",
+	"Apns-Topic":       "apns-topic",
+	"Authorization":    "authorization",
+	"Content-Type":     "content-type",
+	"User-Agent":       "user-agent",
+}
+
+// writeHeaders encodes the request headers and writes the HEADERS frame and
+// its CONTINUATION frames. It must be called with the write lock.
+func (cc *transportConn) writeHeaders(id uint32, req *http.Request, length int) error {
+	cc.hbuf.Reset()
+	write := func(name, value string, sensitive bool) {
+		cc.henc.WriteField(hpack.HeaderField{Name: name, Value: value,
+			Sensitive: sensitive})
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	write(":method", req.Method, false)
+	write(":scheme", "https", false)
+	write(":authority", host, false)
+	write(":path", req.URL.RequestURI(), true)
+	for key, values := range req.Header {
+		name, ok := lowerHeaders[key]
+		if !ok {
+			name = strings.ToLower(key)
+		}
+		var sensitive bool
+		switch name {
+		case "connection", "keep-alive", "proxy-connection", "transfer-encoding",
+			"upgrade", "host", "content-length":
+			continue
+		case "authorization":
+			sensitive = true
+		default:
+			if neverIndexed[name] {
+				sensitive = cc.indexed[name]
+				cc.indexed[name] = true
+			}
+		}
+		for _, value := range values {
+			write(name, value, sensitive)
+		}
+	}
+	if length > 0 {
+		write("content-length", strconv.Itoa(length), false)
+	}
+	cc.mu.Lock()
+	maxFrameSize := int(cc.maxFrameSize)
+	cc.mu.Unlock()
+	block := cc.hbuf.Bytes()
+	for first := true; first || len(block) > 0; first = false {
+		chunk := block
+		if len(chunk) > maxFrameSize {
+			chunk = chunk[:maxFrameSize]
+		}
+		block = block[len(chunk):]
+		var err error
+		if first {
+			err = cc.fr.WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      id,
+				BlockFragment: chunk,
+				EndStream:     length == 0,
+				EndHeaders:    len(block) == 0,
+			})
+		} else {
+			err = cc.fr.WriteContinuation(id, len(block) == 0, chunk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return cc.bw.Flush()
+}
+
+// writeData writes the request body with the DATA frames within the flow
+// control windows.
+func (cc *transportConn) writeData(cs *clientStream, body []byte) error {
+	for len(body) > 0 {
+		cc.mu.Lock()
+		for cc.err == nil && cs.err == nil && (cc.window <= 0 || cs.window <= 0) {
+			cc.cond.Wait()
+		}
+		if cs.err != nil || cc.err != nil {
+			cc.mu.Unlock()
+			return nil // the stream is finished with the error
+		}
+		n := len(body)
+		for _, limit := range []int{int(cc.window), int(cs.window), int(cc.maxFrameSize)} {
+			if n > limit {
+				n = limit
+			}
+		}
+		cc.window -= int32(n)
+		cs.window -= int32(n)
+		cc.mu.Unlock()
+
+		cc.wmu.Lock()
+		err := cc.fr.WriteData(cs.id, n == len(body), body[:n])
+		if err == nil {
+			err = cc.bw.Flush()
+		}
+		cc.wmu.Unlock()
+		if err != nil {
+			return err
+		}
+		body = body[n:]
+	}
+	return nil
+}
+
+// resetStream cancels the stream with the RST_STREAM frame.
+func (cc *transportConn) resetStream(cs *clientStream) {
+	if cc.finish(cs.id, context.Canceled) == nil {
+		return
+	}
+	cc.wmu.Lock()
+	if cc.fr.WriteRSTStream(cs.id, http2.ErrCodeCancel) == nil {
+		cc.bw.Flush()
+	}
+	cc.wmu.Unlock()
+}
+
+// finish removes the active stream and completes it with the error. It
+// returns the removed stream or nil.
+func (cc *transportConn) finish(id uint32, err error) *clientStream {
+	cc.mu.Lock()
+	cs := cc.streams[id]
+	if cs != nil {
+		delete(cc.streams, id)
+		cs.err = err
+		close(cs.done)
+		cc.cond.Broadcast()
+	}
+	idle := cc.goAway != nil && len(cc.streams) == 0
+	cc.mu.Unlock()
+	if idle {
+		cc.close(nil)
+	}
+	return cs
+}
+
+// close closes the connection and completes its streams with the error.
+func (cc *transportConn) close(err error) {
+	cc.mu.Lock()
+	if cc.err != nil {
+		cc.mu.Unlock()
+		return
+	}
+	if cc.goAway != nil {
+		err = *cc.goAway
+	} else if err == nil || err == io.EOF {
+		err = ErrTransportClosed
+	}
+	cc.err = err
+	for id, cs := range cc.streams {
+		delete(cc.streams, id)
+		cs.err = err
+		close(cs.done)
+	}
+	cc.cond.Broadcast()
+	close(cc.closed)
+	cc.mu.Unlock()
+	cc.conn.Close()
+	cc.t.removeConn(cc)
+}
+
+// stream returns the active stream.
+func (cc *transportConn) stream(id uint32) *clientStream {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.streams[id]
+}
+
+// readLoop reads the frames of the connection until it is closed.
+func (cc *transportConn) readLoop() {
+	cc.close(cc.readFrames())
+}
+
+// readFrames reads and handles the frames of the server.
+func (cc *transportConn) readFrames() error {
+	for {
+		f, err := cc.fr.ReadFrame()
+		if err != nil {
+			return err
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			err = cc.handleSettings(f)
+		case *http2.MetaHeadersFrame:
+			if cs := cc.stream(f.StreamID); cs != nil && cs.header == nil {
+				cs.status, _ = strconv.Atoi(f.PseudoValue("status"))
+				cs.header = make(http.Header, len(f.RegularFields()))
+				for _, field := range f.RegularFields() {
+					key := textproto.CanonicalMIMEHeaderKey(field.Name)
+					cs.header[key] = append(cs.header[key], field.Value)
+				}
+			}
+			if f.StreamEnded() {
+				cc.finish(f.StreamID, nil)
+			}
+		case *http2.DataFrame:
+			err = cc.handleData(f)
+		case *http2.RSTStreamFrame:
+			cc.finish(f.StreamID, http2.StreamError{StreamID: f.StreamID,
+				Code: f.ErrCode})
+		case *http2.WindowUpdateFrame:
+			cc.mu.Lock()
+			if f.StreamID == 0 {
+				cc.window += int32(f.Increment)
+			} else if cs := cc.streams[f.StreamID]; cs != nil {
+				cs.window += int32(f.Increment)
+			}
+			cc.cond.Broadcast()
+			cc.mu.Unlock()
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				err = cc.write(func() error { return cc.fr.WritePing(true, f.Data) })
+				break
+			}
+			cc.mu.Lock()
+			if ack := cc.pings[f.Data]; ack != nil {
+				delete(cc.pings, f.Data)
+				close(ack)
+			}
+			cc.mu.Unlock()
+		case *http2.GoAwayFrame:
+			cc.handleGoAway(f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// write writes the frame with the write lock and flushes it.
+func (cc *transportConn) write(frame func() error) error {
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	if err := frame(); err != nil {
+		return err
+	}
+	return cc.bw.Flush()
+}
+
+// handleSettings applies and acknowledges the server settings.
+func (cc *transportConn) handleSettings(f *http2.SettingsFrame) error {
+	if f.IsAck() {
+		return nil
+	}
+	var tableSize uint32 = 4096
+	cc.mu.Lock()
+	f.ForeachSetting(func(s http2.Setting) error {
+		switch s.ID {
+		case http2.SettingMaxConcurrentStreams:
+			cc.maxStreams = s.Val
+		case http2.SettingMaxFrameSize:
+			cc.maxFrameSize = s.Val
+		case http2.SettingHeaderTableSize:
+			tableSize = s.Val
+		case http2.SettingInitialWindowSize:
+			delta := int32(s.Val) - cc.streamWindow
+			cc.streamWindow = int32(s.Val)
+			for _, cs := range cc.streams {
+				cs.window += delta
+			}
+		}
+		return nil
+	})
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+	return cc.write(func() error {
+		cc.henc.SetMaxDynamicTableSizeLimit(tableSize)
+		return cc.fr.WriteSettingsAck()
+	})
+}
+
+// handleData buffers the response body and returns the received data to
+// the flow control windows.
+func (cc *transportConn) handleData(f *http2.DataFrame) error {
+	cs := cc.stream(f.StreamID)
+	if cs != nil {
+		cs.body.Write(f.Data())
+	}
+	if n := f.Header().Length; n > 0 {
+		err := cc.write(func() error {
+			if cs != nil && !f.StreamEnded() {
+				if err := cc.fr.WriteWindowUpdate(cs.id, n); err != nil {
+					return err
+				}
+			}
+			return cc.fr.WriteWindowUpdate(0, n)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if f.StreamEnded() {
+		cc.finish(f.StreamID, nil)
+	}
+	return nil
+}
+
+// handleGoAway stops new streams of the connection, completes the streams not
+// processed by the server to resend them and reports the GOAWAY event.
+func (cc *transportConn) handleGoAway(f *http2.GoAwayFrame) {
+	goAway := &http2.GoAwayError{LastStreamID: f.LastStreamID, ErrCode: f.ErrCode,
+		DebugData: string(f.DebugData())}
+	var unprocessed int
+	cc.mu.Lock()
+	cc.goAway = goAway
+	for id, cs := range cc.streams {
+		if id > f.LastStreamID {
+			delete(cc.streams, id)
+			cs.err = unprocessedError{*goAway}
+			close(cs.done)
+			unprocessed++
+		}
+	}
+	idle := len(cc.streams) == 0
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+	cc.t.removeConn(cc)
+	if cc.t.OnGoAway != nil {
+		cc.t.OnGoAway(newGoAway(*goAway, unprocessed))
+	}
+	if idle {
+		cc.close(*goAway)
+	}
+}
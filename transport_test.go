@@ -0,0 +1,273 @@
+package apns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2Server is a raw HTTP/2 server to test the frames of the Transport.
+type h2Server struct {
+	*httptest.Server
+	mu      sync.Mutex
+	headers [][]hpack.HeaderField // received request headers
+	conns   int                   // accepted connections
+	pings   int                   // received PING frames
+	noAck   bool                  // do not acknowledge the PING frames
+	// serve answers the request stream; 200 by default
+	serve func(c *h2ServerConn, streamID uint32)
+}
+
+// h2ServerConn is the connection of the raw HTTP/2 server.
+type h2ServerConn struct {
+	fr  *http2.Framer
+	enc *hpack.Encoder
+	buf bytes.Buffer
+}
+
+// respond writes the response to the stream.
+func (c *h2ServerConn) respond(streamID uint32, status int, body string) {
+	c.buf.Reset()
+	c.enc.WriteField(hpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)})
+	c.enc.WriteField(hpack.HeaderField{Name: "apns-id",
+		Value: "22222222-2222-2222-2222-222222222222"})
+	c.fr.WriteHeaders(http2.HeadersFrameParam{StreamID: streamID,
+		BlockFragment: c.buf.Bytes(), EndHeaders: true, EndStream: body == ""})
+	if body != "" {
+		c.fr.WriteData(streamID, true, []byte(body))
+	}
+}
+
+// newH2Server starts the raw HTTP/2 TLS server.
+func newH2Server(t testing.TB) *h2Server {
+	s := new(h2Server)
+	s.Server = httptest.NewUnstartedServer(nil)
+	s.TLS = &tls.Config{NextProtos: []string{http2.NextProtoTLS}}
+	s.Config.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){
+		http2.NextProtoTLS: func(_ *http.Server, conn *tls.Conn, _ http.Handler) {
+			s.serveConn(conn)
+		},
+	}
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *h2Server) serveConn(conn *tls.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.conns++
+	s.mu.Unlock()
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil {
+		return
+	}
+	c := &h2ServerConn{fr: http2.NewFramer(conn, conn)}
+	c.enc = hpack.NewEncoder(&c.buf)
+	c.fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	c.fr.WriteSettings(http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: 10})
+	for {
+		f, err := c.fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		var ended uint32
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				c.fr.WriteSettingsAck()
+			}
+		case *http2.PingFrame:
+			s.mu.Lock()
+			s.pings++
+			noAck := s.noAck
+			s.mu.Unlock()
+			if !f.IsAck() && !noAck {
+				c.fr.WritePing(true, f.Data)
+			}
+		case *http2.MetaHeadersFrame:
+			s.mu.Lock()
+			s.headers = append(s.headers, f.Fields)
+			s.mu.Unlock()
+			if f.StreamEnded() {
+				ended = f.StreamID
+			}
+		case *http2.DataFrame:
+			if f.StreamEnded() {
+				ended = f.StreamID
+			}
+		}
+		if ended == 0 {
+			continue
+		}
+		s.mu.Lock()
+		serve := s.serve
+		s.mu.Unlock()
+		if serve != nil {
+			serve(c, ended)
+		} else {
+			c.respond(ended, http.StatusOK, "")
+		}
+	}
+}
+
+// client returns a Client with the Transport connected to the server.
+func (s *h2Server) client(t testing.TB) *Client {
+	f := &fakeAPNs{Server: s.Server}
+	client, _ := f.tokenClient(t)
+	client.EnableHPACK()
+	return client
+}
+
+func TestTransportHPACK(t *testing.T) {
+	s := newH2Server(t)
+	client := s.client(t)
+	for i := 0; i < 3; i++ {
+		_, err := client.Send(context.Background(), Notification{
+			Token:      testToken,
+			ID:         "123e4567-e89b-12d3-a456-4266554400a" + strconv.Itoa(i),
+			Topic:      "com.example.app",
+			Expiration: time.Now().Add(time.Hour),
+			CollapseID: "collapse",
+			Payload:    `{"aps":{"alert":"hello"}}`,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns != 1 || len(s.headers) != 3 {
+		t.Fatalf("bad connections %d and requests %d", s.conns, len(s.headers))
+	}
+	for i, fields := range s.headers {
+		for _, field := range fields {
+			var sensitive bool
+			switch field.Name {
+			case ":path", "authorization":
+				sensitive = true
+			case "apns-id", "apns-expiration", "apns-collapse-id":
+				sensitive = i > 0 // indexed only the first time
+			}
+			if field.Sensitive != sensitive {
+				t.Errorf("request %d: %s sensitive %v", i, field.Name, field.Sensitive)
+			}
+		}
+	}
+	if path := s.headers[0][3]; path.Name != ":path" || path.Value != "/3/device/"+testToken {
+		t.Error("bad path:", path)
+	}
+}
+
+func TestTransportMultiplex(t *testing.T) {
+	f := newFakeAPNs(t)
+	f.reply = func(r *http.Request) (int, string) {
+		if r.Header.Get("apns-topic") == "bad" {
+			return http.StatusBadRequest, "BadTopic"
+		}
+		return http.StatusOK, ""
+	}
+	client := f.client(t)
+	transport := client.EnableHPACK()
+	defer client.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Push(Notification{Token: testToken,
+				Payload: []byte(`{"aps":{}}`)}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	addrs := make(map[string]bool)
+	f.mu.Lock()
+	for _, r := range f.requests {
+		addrs[r.RemoteAddr] = true
+	}
+	f.mu.Unlock()
+	if f.count() != 50 || len(addrs) != 1 {
+		t.Errorf("bad requests %d with %d connections", f.count(), len(addrs))
+	}
+	_, err := client.Push(Notification{Token: testToken, Topic: "bad"})
+	if err, ok := err.(*Error); !ok || err.Reason != "BadTopic" {
+		t.Error("bad error:", err)
+	}
+	client.Close()
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if len(transport.conns) != 0 {
+		t.Error("idle connections are not closed")
+	}
+}
+
+func TestTransportGoAway(t *testing.T) {
+	s := newH2Server(t)
+	s.serve = func(c *h2ServerConn, streamID uint32) {
+		c.fr.WriteGoAway(0, http2.ErrCodeNo, []byte(`{"reason":"Shutdown"}`))
+	}
+	client := s.client(t)
+	_, err := client.Push(Notification{Token: testToken})
+	if err, ok := err.(*Error); !ok || err.Reason != "Shutdown" {
+		t.Fatal("bad error:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.mu.Lock()
+	s.serve = func(*h2ServerConn, uint32) {} // never responds
+	s.mu.Unlock()
+	if _, err := client.Send(ctx, Notification{Token: testToken}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("bad error:", err)
+	}
+}
+
+func TestTransportSharedDial(t *testing.T) {
+	f := newFakeAPNs(t)
+	client := f.client(t)
+	// the slow proxy keeps the dial in progress
+	proxy := newTestProxy(t, false)
+	proxy.mu.Lock()
+	proxy.delay = 50 * time.Millisecond
+	proxy.mu.Unlock()
+	client.SetProxy(proxy.URL())
+	client.EnableHPACK()
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := client.Send(ctx, Notification{Token: testToken})
+		canceled <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Send(context.Background(), Notification{Token: testToken})
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Error("bad error of the canceled request:", err)
+	}
+	// the request waiting for the same dial is not canceled
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if proxy.count() != 1 {
+		t.Error("bad connections count:", proxy.count())
+	}
+}
@@ -0,0 +1,81 @@
+package apns
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Topic suffixes of the PushKit notifications added to the bundle ID of the
+// app.
+const (
+	VoIPTopicSuffix       = ".voip"
+	PushToTalkTopicSuffix = ".voip-ptt"
+)
+
+// NewVoIP returns the Voice over Internet Protocol (VoIP) notification for
+// the app with the bundle ID. If the bundle ID is empty, the client sends it
+// to the VoIP topic of the certificate bundle ID.
+//
+// VoIP notifications must be delivered without delay: they are sent with the
+// high priority and expire immediately, so APNs does not store them for the
+// offline devices. The payload size is limited to 5KB (5120 bytes).
+func NewVoIP(token, bundleID string, payload interface{}) (Notification, error) {
+	return newPushKit(token, bundleID, VoIPTopicSuffix, PushTypeVoIP, payload)
+}
+
+// NewPushToTalk returns the push-to-talk notification for the app with the
+// bundle ID, delivered like the VoIP notification to the topic with the
+// PushToTalkTopicSuffix.
+func NewPushToTalk(token, bundleID string, payload interface{}) (
+	Notification, error) {
+	return newPushKit(token, bundleID, PushToTalkTopicSuffix, PushTypePushToTalk,
+		payload)
+}
+
+// newPushKit returns the PushKit notification to the topic with the suffix
+// and checks the payload size.
+func newPushKit(token, app, suffix, pushType string,
+	payload interface{}) (Notification, error) {
+	n := Notification{
+		Token:      token,
+		Expiration: ExpireNow,
+		PushType:   pushType,
+		Payload:    payload,
+	}
+	if app != "" {
+		n.Topic = bundleID(app) + suffix
+	}
+	data, err := n.body()
+	if err != nil {
+		return n, err
+	}
+	if len(data) > n.maxPayloadSize() {
+		return n, &Error{Status: http.StatusRequestEntityTooLarge,
+			Reason: "PayloadTooLarge"}
+	}
+	return n, nil
+}
+
+// pushKitTopic sets the PushKit topic of the certificate for the VoIP or
+// push-to-talk notification and checks the certificate supports it.
+func (c *Client) pushKitTopic(n *Notification) error {
+	var suffix string
+	switch n.PushType {
+	case PushTypeVoIP:
+		suffix = VoIPTopicSuffix
+	case PushTypePushToTalk:
+		suffix = PushToTalkTopicSuffix
+	default:
+		return nil
+	}
+	if c.ci == nil {
+		return nil
+	}
+	if n.Topic == "" {
+		n.Topic = bundleID(c.ci.BundleID) + suffix
+	}
+	if !strings.HasSuffix(n.Topic, suffix) || !c.ci.Support(n.Topic) {
+		return &Error{Status: http.StatusBadRequest, Reason: "TopicDisallowed"}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package apns
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVoIP(t *testing.T) {
+	f := newFakeAPNs(t)
+	client := f.client(t)
+	client.ci = &CertificateInfo{BundleID: "com.example.app",
+		Topics: []string{"com.example.app", "com.example.app.voip"}}
+	payload := `{"aps":{},"data":"` + strings.Repeat("x", 4500) + `"}`
+	n, err := NewVoIP(testToken, "", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := f.last()
+	for key, value := range map[string]string{
+		"apns-topic":      "com.example.app.voip",
+		"apns-push-type":  PushTypeVoIP,
+		"apns-expiration": "0",
+		"apns-priority":   "",
+	} {
+		if r.Header.Get(key) != value {
+			t.Errorf("bad %s: %q", key, r.Header.Get(key))
+		}
+	}
+
+	// the scheduled VoIP notification is not expired
+	responses := make(chan Response, 1)
+	pool := client.Pool(1, responses)
+	defer pool.Close()
+	pool.PushAfter(10*time.Millisecond, n, testToken)
+	select {
+	case r := <-responses:
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("scheduled notification is not sent")
+	}
+	if r, _ := f.last(); r.Header.Get("apns-expiration") != "0" {
+		t.Error("bad scheduled expiration:", r.Header.Get("apns-expiration"))
+	}
+
+	// the certificate does not support push-to-talk
+	if n, err = NewPushToTalk(testToken, "com.example.app", `{}`); err != nil {
+		t.Fatal(err)
+	}
+	if n.Topic != "com.example.app.voip-ptt" || n.PushType != PushTypePushToTalk {
+		t.Error("bad push-to-talk notification:", n.Topic, n.PushType)
+	}
+	_, err = client.Send(context.Background(), n)
+	if err, ok := err.(*Error); !ok || err.Reason != "TopicDisallowed" {
+		t.Error("bad push-to-talk error:", err)
+	}
+
+	// payload size limits
+	if _, err := NewPushToTalk(testToken, "com.example.app", payload); err == nil {
+		t.Error("push-to-talk payload exceeds 4KB")
+	}
+	payload = `{"aps":{},"data":"` + strings.Repeat("x", 5120) + `"}`
+	if _, err := NewVoIP(testToken, "com.example.app", payload); err == nil {
+		t.Error("VoIP payload exceeds 5KB")
+	}
+}
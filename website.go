@@ -0,0 +1,88 @@
+package apns
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// WebsiteTopicPrefix is the prefix of the Website Push ID, the topic of the
+// Safari website push certificate.
+const WebsiteTopicPrefix = "web."
+
+// Website push payload errors.
+var (
+	ErrWebsiteAlert   = errors.New("website push without alert title or body")
+	ErrWebsiteURLArgs = errors.New("website push url-args do not match the URL format")
+)
+
+// WebsitePush is the payload of the Safari website push notification. Use it
+// as the Notification Payload or get the ready notification with the
+// Notification method.
+//
+// When the user clicks the notification, Safari opens the URL made from the
+// urlFormatString of the push package and the URLArgs: the number of
+// arguments must match the number of placeholders in the format.
+type WebsitePush struct {
+	Title   string   // title of the notification
+	Body    string   // text of the notification
+	Action  string   // label of the action button
+	URLArgs []string // arguments of the URL format string
+}
+
+// jsonWebsitePush is the aps dictionary of the website push payload.
+type jsonWebsitePush struct {
+	Alert struct {
+		Title  string `json:"title"`
+		Body   string `json:"body"`
+		Action string `json:"action,omitempty"`
+	} `json:"alert"`
+	URLArgs []string `json:"url-args"`
+}
+
+// MarshalJSON returns the payload of the website push notification.
+func (w WebsitePush) MarshalJSON() ([]byte, error) {
+	var aps = &jsonWebsitePush{URLArgs: w.URLArgs}
+	aps.Alert.Title = w.Title
+	aps.Alert.Body = w.Body
+	aps.Alert.Action = w.Action
+	if aps.URLArgs == nil {
+		aps.URLArgs = []string{} // url-args is required
+	}
+	return json.Marshal(map[string]*jsonWebsitePush{"aps": aps})
+}
+
+// Validate checks the alert of the website push.
+func (w WebsitePush) Validate() error {
+	if w.Title == "" || w.Body == "" {
+		return ErrWebsiteAlert
+	}
+	return nil
+}
+
+// Notification returns the notification to the device token of the website
+// with the Website Push ID.
+func (w WebsitePush) Notification(token, websitePushID string) (
+	Notification, error) {
+	n := Notification{
+		Token:    token,
+		Topic:    websitePushID,
+		PushType: PushTypeAlert,
+		Payload:  w,
+	}
+	return n, w.Validate()
+}
+
+// CheckURLArgs checks the number of the URL arguments matches the number of
+// the placeholders in the URL format string of the push package.
+func (w WebsitePush) CheckURLArgs(urlFormatString string) error {
+	if strings.Count(urlFormatString, "%@") != len(w.URLArgs) {
+		return ErrWebsiteURLArgs
+	}
+	return nil
+}
+
+// isWebsite returns true if the topic is the Website Push ID.
+func isWebsite(topic string) bool {
+	return strings.HasPrefix(topic, WebsiteTopicPrefix)
+}
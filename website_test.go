@@ -0,0 +1,150 @@
+package apns
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestWebsitePush(t *testing.T) {
+	cert := testCertificate(t, "web.com.example")
+	info := GetCertificateInfo(cert)
+	if !info.Website || info.MDM {
+		t.Fatalf("bad certificate info: %+v", info)
+	}
+	f := newFakeAPNs(t)
+	client := f.client(t)
+	client.ci = info
+	push := &WebsitePush{Title: "Flight A998 Now Boarding",
+		Body: "Boarding has begun for Flight A998.", Action: "View",
+		URLArgs: []string{"boarding", "A998"}}
+	if err := push.CheckURLArgs("https://example.com/%@/?flight=%@"); err != nil {
+		t.Error(err)
+	}
+	n, err := push.Notification(testToken, info.BundleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Chain(client, Validate).Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	r, body := f.last()
+	if r.Header.Get("apns-topic") != "web.com.example" {
+		t.Error("bad topic:", r.Header.Get("apns-topic"))
+	}
+	const payload = `{"aps":{"alert":{"title":"Flight A998 Now Boarding",` +
+		`"body":"Boarding has begun for Flight A998.","action":"View"},` +
+		`"url-args":["boarding","A998"]}}`
+	if string(body) != payload {
+		t.Error("bad payload:", string(body))
+	}
+	// the payload value is validated and encoded like the pointer
+	n.Payload = *push
+	if _, err := Chain(client, Validate).Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := f.last(); string(body) != payload {
+		t.Error("bad value payload:", string(body))
+	}
+	n.Payload = WebsitePush{Title: "Title"}
+	if _, err := Chain(client, Validate).Send(context.Background(), n); err != ErrWebsiteAlert {
+		t.Error("bad value alert error:", err)
+	}
+	if _, err := (&WebsitePush{Title: "Title"}).Notification(testToken,
+		info.BundleID); err != ErrWebsiteAlert {
+		t.Error("bad alert error:", err)
+	}
+	if err := push.CheckURLArgs("https://example.com/%@"); err != ErrWebsiteURLArgs {
+		t.Error("bad url-args error:", err)
+	}
+}
+
+func TestPushPackage(t *testing.T) {
+	cert := testCertificate(t, "web.com.example")
+	pkg := &PushPackage{
+		Website: Website{
+			WebsiteName:         "Example",
+			WebsitePushID:       "web.com.example",
+			AllowedDomains:      []string{"https://example.com"},
+			URLFormatString:     "https://example.com/%@/?flight=%@",
+			AuthenticationToken: "19f8d7a6e9fb8a7f6d9330dabe",
+			WebServiceURL:       "https://example.com/push",
+		},
+		Icons: map[string][]byte{"icon_16x16.png": []byte("png")},
+	}
+	var buf bytes.Buffer
+	if err := pkg.Write(&buf, cert); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+	var manifest map[string]struct{ HashType, HashValue string }
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != 2 {
+		t.Error("bad manifest:", manifest)
+	}
+	for name, hash := range manifest {
+		sum := sha512.Sum512(files[name])
+		if hash.HashType != "sha512" || hash.HashValue != hex.EncodeToString(sum[:]) {
+			t.Error("bad manifest hash:", name)
+		}
+	}
+
+	// verify the signature of the manifest
+	var info pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(files["signature"], &info); err != nil {
+		t.Fatal(err)
+	}
+	var signed pkcs7SignedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &signed); err != nil {
+		t.Fatal(err)
+	}
+	if !info.ContentType.Equal(oidSignedData) || len(signed.Certificates) != 1 ||
+		len(signed.SignerInfos) != 1 {
+		t.Fatalf("bad signed data: %+v", signed)
+	}
+	signer := signed.SignerInfos[0]
+	attributes := append([]byte{0x31}, signer.AuthenticatedAttributes.FullBytes[1:]...)
+	var attrs []pkcs7Attribute
+	if _, err := asn1.UnmarshalWithParams(attributes, &attrs, "set"); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(files["manifest.json"])
+	var found bool
+	for _, attr := range attrs {
+		if attr.Type.Equal(oidMessageDigest) {
+			var value []byte
+			asn1.Unmarshal(attr.Values[0].FullBytes, &value)
+			found = bytes.Equal(value, digest[:])
+		}
+	}
+	if !found {
+		t.Error("bad message digest")
+	}
+	sum := sha256.Sum256(attributes)
+	key := cert.PrivateKey.(*ecdsa.PrivateKey)
+	if !ecdsa.VerifyASN1(&key.PublicKey, sum[:], signer.EncryptedDigest) {
+		t.Error("signature is not verified")
+	}
+}